@@ -0,0 +1,46 @@
+package hangups
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+// Annotation type of "/me" actions.
+const ActionAnnotationType int32 = 4
+
+// Return an annotation marking a chat message as a "/me" action.
+func NewActionAnnotation() *hangouts.EventAnnotation {
+	return &hangouts.EventAnnotation{Type: proto.Int32(ActionAnnotationType)}
+}
+
+// Return the annotations of a chat message event, nil for other events.
+func EventAnnotations(event *hangouts.Event) []*hangouts.EventAnnotation {
+	return event.GetChatMessage().GetAnnotation()
+}
+
+// Report whether a chat message event carries any annotation.
+func HasAnnotations(event *hangouts.Event) bool {
+	return len(EventAnnotations(event)) > 0
+}
+
+// Report whether a chat message event is a "/me" action.
+func IsActionEvent(event *hangouts.Event) bool {
+	for _, annotation := range EventAnnotations(event) {
+		if annotation.GetType() == ActionAnnotationType {
+			return true
+		}
+	}
+	return false
+}
+
+// Split "/me waves" into "waves" and true. Text without the "/me " prefix
+// is returned unchanged with false. Bridges can use it to turn typed
+// commands (or IRC ACTIONs turned into "/me ...") into SendAction calls.
+func ParseAction(text string) (string, bool) {
+	if !strings.HasPrefix(text, "/me ") {
+		return text, false
+	}
+	return strings.TrimLeft(text[len("/me "):], " "), true
+}
@@ -0,0 +1,248 @@
+package hangups
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Active Client
+*
+* Only the active client of a user gets notifications: while one is active,
+* phones don't ring for new messages. A client stays active for the timeout
+* it passes to SetActiveClient, so ActiveClientManager repeats the call while
+* there is activity, and tracks the ActiveClientState the server reports in
+* the header of every StateUpdate.
+ */
+
+// Time a client stays active after SetActiveClient, as used by hangups.
+const ActiveClientTimeout = 120 * time.Second
+
+// Called when the ActiveClientState reported by the server changes.
+type ActiveClientStateHandler func(state hangouts.ActiveClientState)
+
+// Keeps the client active while events flow, safe for concurrent use. The
+// client id comes from the push channel, see Start.
+//
+//	active := hangups.NewActiveClientManager(client)
+//	active.SetClientId(channelClientId)
+//	if err := active.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer active.Stop()
+type ActiveClientManager struct {
+	client        *Client
+	removeHandler func() // removes the StateUpdate handler, see Close
+
+	// How long the client stays active after the last activity,
+	// ActiveClientTimeout when zero. Takes effect on Start.
+	Timeout time.Duration
+
+	email        string
+	clientId     string
+	state        hangouts.ActiveClientState
+	lastActivity time.Time
+	lastSet      time.Time
+	lock         sync.Mutex
+
+	done    chan struct{} // closed to stop the keepalive loop
+	stopped chan struct{} // closed when the keepalive loop returned
+
+	handlers     []*ActiveClientStateHandler // by pointer, so they can be removed
+	handlersLock sync.RWMutex
+}
+
+// Create a manager that counts every StateUpdate the client processes as
+// activity, and tracks the ActiveClientState of their headers.
+func NewActiveClientManager(c *Client) *ActiveClientManager {
+	manager := &ActiveClientManager{client: c}
+	manager.removeHandler = c.AddStateUpdateHandler(func(update *hangouts.StateUpdate) {
+		manager.Touch()
+		if header := update.StateUpdateHeader; header != nil && header.ActiveClientState != nil {
+			manager.setState(header.GetActiveClientState())
+		}
+	})
+	return manager
+}
+
+// Register a handler to be called when the ActiveClientState changes. Call
+// the returned function to remove it.
+func (m *ActiveClientManager) AddStateHandler(handler ActiveClientStateHandler) func() {
+	entry := &handler
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	m.handlers = append(m.handlers, entry)
+	return func() {
+		m.handlersLock.Lock()
+		defer m.handlersLock.Unlock()
+		handlers := make([]*ActiveClientStateHandler, 0, len(m.handlers))
+		for _, registered := range m.handlers {
+			if registered != entry {
+				handlers = append(handlers, registered)
+			}
+		}
+		m.handlers = handlers
+	}
+}
+
+// Stop, then stop following the StateUpdates the client processes.
+func (m *ActiveClientManager) Close() error {
+	err := m.Stop()
+	m.removeHandler()
+	return err
+}
+
+// Return the last ActiveClientState reported by the server.
+func (m *ActiveClientManager) State() hangouts.ActiveClientState {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.state
+}
+
+// Report whether the server last reported this client as the active one.
+func (m *ActiveClientManager) IsActive() bool {
+	return m.State() == hangouts.ActiveClientState_ACTIVE_CLIENT_STATE_IS_ACTIVE
+}
+
+// Record activity, such as the user sending a message. The client is kept
+// active for Timeout after the last activity.
+func (m *ActiveClientManager) Touch() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.lastActivity = time.Now()
+}
+
+// Set the id the channel assigned to this client, in place of the client's
+// ClientId. The client is made active under the new id on the next
+// keepalive.
+func (m *ActiveClientManager) SetClientId(clientId string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.clientId = clientId
+	m.lastSet = time.Time{}
+}
+
+// Make the client active and keep it active while there is activity, until
+// Stop. The email comes from SelfEntity, which GetSelfInfo is called for if
+// needed. The client id is the one passed to SetClientId, else the
+// client's ClientId; Start fails without one, as the server only accepts ids
+// assigned by a channel. This package opens no channel: a client running one
+// reads the id from the data the channel pushes after connecting, and passes
+// it to SetClientId.
+func (m *ActiveClientManager) Start() error {
+	m.lock.Lock()
+	if m.done != nil {
+		m.lock.Unlock()
+		return nil
+	}
+	m.lock.Unlock()
+
+	self := m.client.SelfEntity()
+	if self == nil {
+		if _, err := m.client.GetSelfInfo(); err != nil {
+			return err
+		}
+		self = m.client.SelfEntity()
+	}
+	if len(self.GetProperties().GetEmail()) == 0 {
+		return errors.New("Can't set active client without the self user's email")
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.done != nil {
+		return nil
+	}
+	if m.clientId == "" {
+		m.clientId = m.client.ClientId
+	}
+	if m.clientId == "" {
+		return errors.New("Can't set active client without a ClientId")
+	}
+	m.email = self.Properties.Email[0]
+	m.lastActivity = time.Now()
+	m.lastSet = time.Time{}
+	m.done = make(chan struct{})
+	m.stopped = make(chan struct{})
+	go m.keepaliveLoop(m.done, m.stopped, m.timeout())
+	return nil
+}
+
+// Stop the keepalive and tell the server this client isn't active anymore,
+// so notifications go to the user's other clients right away.
+func (m *ActiveClientManager) Stop() error {
+	m.lock.Lock()
+	done, stopped, email, clientId := m.done, m.stopped, m.email, m.clientId
+	m.done, m.stopped = nil, nil
+	m.lock.Unlock()
+	if done == nil {
+		return nil
+	}
+	close(done)
+	<-stopped
+
+	_, err := m.client.setActiveClient(email, clientId, false, uint64(m.timeout()/time.Second))
+	return err
+}
+
+func (m *ActiveClientManager) timeout() time.Duration {
+	if m.Timeout <= 0 {
+		return ActiveClientTimeout
+	}
+	return m.Timeout
+}
+
+func (m *ActiveClientManager) keepaliveLoop(done, stopped chan struct{}, timeout time.Duration) {
+	defer close(stopped)
+	m.keepalive(timeout)
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.keepalive(timeout)
+		}
+	}
+}
+
+// Set the client active again if there was activity since it was last set
+// and it is half way to timing out. A failed call is retried on the next
+// tick.
+func (m *ActiveClientManager) keepalive(timeout time.Duration) {
+	m.lock.Lock()
+	now := time.Now()
+	due := now.Sub(m.lastActivity) < timeout && m.lastActivity.After(m.lastSet) &&
+		now.Sub(m.lastSet) >= timeout/2
+	email, clientId := m.email, m.clientId
+	m.lock.Unlock()
+	if !due {
+		return
+	}
+	if _, err := m.client.setActiveClient(email, clientId, true, uint64(timeout/time.Second)); err != nil {
+		return
+	}
+	m.lock.Lock()
+	m.lastSet = now
+	m.lock.Unlock()
+}
+
+func (m *ActiveClientManager) setState(state hangouts.ActiveClientState) {
+	m.lock.Lock()
+	changed := m.state != state
+	m.state = state
+	m.lock.Unlock()
+	if !changed {
+		return
+	}
+	m.handlersLock.RLock()
+	handlers := m.handlers
+	m.handlersLock.RUnlock()
+	for _, handler := range handlers {
+		(*handler)(state)
+	}
+}
@@ -0,0 +1,39 @@
+package hangups
+
+import (
+	"testing"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestActiveClientManagerStartWithoutClientId(t *testing.T) {
+	email := "me@example.com"
+	c := &Client{
+		Session:    &Session{},
+		selfEntity: &hangouts.Entity{Properties: &hangouts.EntityProperties{Email: []string{email}}},
+	}
+	manager := NewActiveClientManager(c)
+	if err := manager.Start(); err == nil {
+		manager.Stop()
+		t.Fatal("Start succeeded without a client id, want an error")
+	}
+	if c.ClientId != "" {
+		t.Errorf("Start set ClientId to %q", c.ClientId)
+	}
+}
+
+func TestActiveClientManagerRemoveStateHandler(t *testing.T) {
+	manager := NewActiveClientManager(&Client{})
+	defer manager.Close()
+	kept, removed := 0, 0
+	manager.AddStateHandler(func(state hangouts.ActiveClientState) { kept++ })
+	remove := manager.AddStateHandler(func(state hangouts.ActiveClientState) { removed++ })
+	remove()
+	remove()
+
+	manager.setState(hangouts.ActiveClientState_ACTIVE_CLIENT_STATE_IS_ACTIVE)
+	manager.setState(hangouts.ActiveClientState_ACTIVE_CLIENT_STATE_OTHER_ACTIVE)
+	if kept != 2 || removed != 0 {
+		t.Errorf("kept handler called %d times, removed one %d times, want 2 and 0", kept, removed)
+	}
+}
@@ -0,0 +1,223 @@
+package hangups
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Attachments
+*
+* Received messages carry photos and places as EmbedItems. Attachments turns
+* them into typed values and DownloadMedia fetches their media, with the
+* session's credentials for Google media hosts only.
+ */
+
+// A photo or place attached to a message. Use a type switch on
+// *PhotoAttachment and *PlaceAttachment to get at the details.
+type Attachment interface {
+	// Url of the attached media, empty if there is none.
+	MediaUrl() string
+}
+
+// A Google+ photo attached to a message.
+type PhotoAttachment struct {
+	PhotoId            string
+	AlbumId            string
+	OwnerId            string
+	Url                string // full-sized image
+	OriginalContentUrl string
+	ThumbnailUrl       string
+	PageUrl            string // album page the thumbnail links to
+	Width              uint64 // thumbnail width in pixels
+	Height             uint64 // thumbnail height in pixels
+	Animated           bool
+}
+
+// Url of the full-sized image, falling back to the original content and
+// then to the thumbnail.
+func (p *PhotoAttachment) MediaUrl() string {
+	if p.Url != "" {
+		return p.Url
+	}
+	if p.OriginalContentUrl != "" {
+		return p.OriginalContentUrl
+	}
+	return p.ThumbnailUrl
+}
+
+// A Google Maps place attached to a message.
+type PlaceAttachment struct {
+	Name     string
+	Url      string // maps url
+	ImageUrl string // map with a pin
+}
+
+// Url of the map image.
+func (p *PlaceAttachment) MediaUrl() string {
+	return p.ImageUrl
+}
+
+// Return the typed attachments of message content, skipping unknown kinds.
+func Attachments(content *hangouts.MessageContent) []Attachment {
+	attachments := make([]Attachment, 0)
+	for _, attachment := range content.GetAttachment() {
+		embedItem := attachment.EmbedItem
+		if photo := embedItem.GetPlusPhoto(); photo != nil {
+			attachments = append(attachments, &PhotoAttachment{
+				PhotoId:            photo.GetPhotoId(),
+				AlbumId:            photo.GetAlbumId(),
+				OwnerId:            photo.GetOwnerObfuscatedId(),
+				Url:                photo.GetUrl(),
+				OriginalContentUrl: photo.GetOriginalContentUrl(),
+				ThumbnailUrl:       photo.Thumbnail.GetImageUrl(),
+				PageUrl:            photo.Thumbnail.GetUrl(),
+				Width:              photo.Thumbnail.GetWidthPx(),
+				Height:             photo.Thumbnail.GetHeightPx(),
+				Animated:           photo.GetMediaType() == hangouts.PlusPhoto_MEDIA_TYPE_ANIMATED_PHOTO,
+			})
+		} else if place := embedItem.GetPlace(); place != nil {
+			attachments = append(attachments, &PlaceAttachment{
+				Name:     place.GetName(),
+				Url:      place.GetUrl(),
+				ImageUrl: place.RepresentativeImage.GetUrl(),
+			})
+		}
+	}
+	return attachments
+}
+
+// Default limit on the size of downloaded media, 50 MB.
+const DefaultMaxMediaSize = 50 * 1024 * 1024
+
+// Limits applied by DownloadMedia.
+type DownloadOptions struct {
+	// Largest accepted download in bytes, DefaultMaxMediaSize when zero.
+	MaxSize int64
+	// Accepted content types. Entries ending in "/" match a whole family
+	// ("image/"). Images and videos are accepted when empty.
+	ContentTypes []string
+	// Hosts, with their subdomains, that get the session's credentials.
+	// DefaultMediaCredentialHosts when empty.
+	CredentialHosts []string
+}
+
+var defaultMediaContentTypes = []string{"image/", "video/"}
+
+// Hosts serving Hangouts media that need the session's credentials. Media
+// from anywhere else is fetched without them.
+var DefaultMediaCredentialHosts = []string{"googleusercontent.com", "ggpht.com"}
+
+// Download https media (see Attachment.MediaUrl) to w and return the
+// number of bytes written. Only requests to the credential hosts carry the
+// session's cookies. Downloads larger than the size limit or with an
+// unexpected content type fail; when the server doesn't announce the size,
+// up to the limit may have been written to w already.
+func (c *Client) DownloadMedia(mediaUrl string, w io.Writer, options *DownloadOptions) (int64, error) {
+	parsedUrl, err := url.Parse(mediaUrl)
+	if err != nil || parsedUrl.Scheme != "https" {
+		return 0, fmt.Errorf("Can't download media from %q", mediaUrl)
+	}
+	if options == nil {
+		options = &DownloadOptions{}
+	}
+	maxSize := options.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMediaSize
+	}
+	contentTypes := options.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultMediaContentTypes
+	}
+
+	credentialHosts := options.CredentialHosts
+	if len(credentialHosts) == 0 {
+		credentialHosts = DefaultMediaCredentialHosts
+	}
+
+	var req *http.Request
+	if matchHost(parsedUrl.Host, credentialHosts) {
+		req, err = c.newAuthenticatedRequest("GET", mediaUrl, nil)
+	} else {
+		req, err = http.NewRequest("GET", mediaUrl, nil)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// net/http drops the credentials on redirects to other domains, but
+	// not on redirects to plain http
+	client := *c.httpClient()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("Refusing media redirect to %q", req.URL.String())
+		}
+		if len(via) >= 10 {
+			return errors.New("Too many media redirects")
+		}
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Media download failed: %s", resp.Status)
+	}
+
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("content-type"))
+	if err != nil || !matchContentType(contentType, contentTypes) {
+		return 0, fmt.Errorf("Unexpected media content type %q", resp.Header.Get("content-type"))
+	}
+	if resp.ContentLength > maxSize {
+		return 0, fmt.Errorf("Media is %d bytes, over the %d bytes limit", resp.ContentLength, maxSize)
+	}
+
+	written, err := io.Copy(w, io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return written, err
+	}
+	// anything left means the media didn't fit
+	if n, _ := io.ReadFull(resp.Body, make([]byte, 1)); n > 0 {
+		return written, errors.New("Media is over the size limit")
+	}
+	return written, nil
+}
+
+// Report whether host, without its port, is one of hosts or a subdomain
+// of one.
+func matchHost(host string, hosts []string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchContentType(contentType string, accepted []string) bool {
+	for _, acceptedType := range accepted {
+		acceptedType = strings.ToLower(acceptedType)
+		if strings.HasSuffix(acceptedType, "/") {
+			if strings.HasPrefix(contentType, acceptedType) {
+				return true
+			}
+		} else if contentType == acceptedType {
+			return true
+		}
+	}
+	return false
+}
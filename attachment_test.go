@@ -0,0 +1,104 @@
+package hangups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newMediaTestServer(headers chan<- http.Header) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://example.com/photo.png", http.StatusFound)
+			return
+		}
+		headers <- r.Header
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+}
+
+func newMediaTestClient(server *httptest.Server) *Client {
+	return &Client{
+		Session:    &Session{Cookies: "SID=secret", Sapisid: "sapisid"},
+		HttpClient: server.Client(),
+	}
+}
+
+func TestDownloadMediaCredentials(t *testing.T) {
+	tests := []struct {
+		name            string
+		credentialHosts []string
+		wantCredentials bool
+	}{
+		{"default hosts", nil, false},
+		{"other host", []string{"googleusercontent.com", "127.0.0.2"}, false},
+		{"allow-listed host", []string{"127.0.0.1"}, true},
+	}
+	for _, test := range tests {
+		headers := make(chan http.Header, 1)
+		server := newMediaTestServer(headers)
+		c := newMediaTestClient(server)
+
+		var out bytes.Buffer
+		written, err := c.DownloadMedia(server.URL+"/photo.png", &out, &DownloadOptions{CredentialHosts: test.credentialHosts})
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: DownloadMedia failed: %v", test.name, err)
+			continue
+		}
+		if written != 3 || out.String() != "png" {
+			t.Errorf("%s: downloaded %d bytes %q, want \"png\"", test.name, written, out.String())
+		}
+
+		header := <-headers
+		gotCredentials := header.Get("Cookie") != "" || header.Get("Authorization") != ""
+		if gotCredentials != test.wantCredentials {
+			t.Errorf("%s: cookie %q, authorization %q, want credentials %v",
+				test.name, header.Get("Cookie"), header.Get("Authorization"), test.wantCredentials)
+		}
+		if test.wantCredentials && header.Get("Cookie") != "SID=secret" {
+			t.Errorf("%s: cookie %q, want \"SID=secret\"", test.name, header.Get("Cookie"))
+		}
+	}
+}
+
+func TestDownloadMediaRefusesPlainHttp(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := newMediaTestServer(headers)
+	defer server.Close()
+	c := newMediaTestClient(server)
+
+	httpUrl := strings.Replace(server.URL, "https://", "http://", 1) + "/photo.png"
+	if _, err := c.DownloadMedia(httpUrl, &bytes.Buffer{}, nil); err == nil {
+		t.Errorf("DownloadMedia(%q) succeeded, want an error", httpUrl)
+	}
+
+	options := &DownloadOptions{CredentialHosts: []string{"127.0.0.1"}}
+	if _, err := c.DownloadMedia(server.URL+"/redirect", &bytes.Buffer{}, options); err == nil {
+		t.Error("DownloadMedia followed a redirect to http, want an error")
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	hosts := []string{"googleusercontent.com", "ggpht.com"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"googleusercontent.com", true},
+		{"lh3.googleusercontent.com", true},
+		{"LH3.GoogleUserContent.com:443", true},
+		{"lh3.ggpht.com", true},
+		{"evilgoogleusercontent.com", false},
+		{"googleusercontent.com.evil.com", false},
+		{"example.com", false},
+	}
+	for _, test := range tests {
+		if got := matchHost(test.host, hosts); got != test.want {
+			t.Errorf("matchHost(%q) = %v, want %v", test.host, got, test.want)
+		}
+	}
+}
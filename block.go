@@ -0,0 +1,55 @@
+package hangups
+
+import (
+	"sort"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+// Block a user. Blocked users can't message or invite the self user.
+func (c *Client) BlockUser(gaiaId string) (*hangouts.SetBlockStateResponse, error) {
+	return c.SetBlockState(gaiaId, true)
+}
+
+// Unblock a previously blocked user.
+func (c *Client) UnblockUser(gaiaId string) (*hangouts.SetBlockStateResponse, error) {
+	return c.SetBlockState(gaiaId, false)
+}
+
+// Return the gaia ids of users known to be blocked, sorted.
+// The api has no way to list blocked users, so this only reflects blocks
+// made through this client and BlockNotifications it has processed.
+func (c *Client) BlockedUsers() []string {
+	c.blockedUsersLock.RLock()
+	defer c.blockedUsersLock.RUnlock()
+	gaiaIds := make([]string, 0, len(c.blockedUsers))
+	for gaiaId := range c.blockedUsers {
+		gaiaIds = append(gaiaIds, gaiaId)
+	}
+	sort.Strings(gaiaIds)
+	return gaiaIds
+}
+
+// Report whether a user is known to be blocked.
+func (c *Client) IsBlocked(gaiaId string) bool {
+	c.blockedUsersLock.RLock()
+	defer c.blockedUsersLock.RUnlock()
+	return c.blockedUsers[gaiaId]
+}
+
+func (c *Client) setBlockStates(blockStateChanges []*hangouts.BlockStateChange) {
+	c.blockedUsersLock.Lock()
+	defer c.blockedUsersLock.Unlock()
+	if c.blockedUsers == nil {
+		c.blockedUsers = make(map[string]bool)
+	}
+	for _, change := range blockStateChanges {
+		gaiaId := change.ParticipantId.GetGaiaId()
+		switch change.GetNewBlockState() {
+		case hangouts.BlockState_BLOCK_STATE_BLOCK:
+			c.blockedUsers[gaiaId] = true
+		case hangouts.BlockState_BLOCK_STATE_UNBLOCK:
+			delete(c.blockedUsers, gaiaId)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package hangups
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Conversation Cache
+*
+* Conversations returned by the api are kept so that later requests can
+* use what the server last told us (view, otr status, etc).
+* Cached conversations are never modified in place. Updates store a modified
+* copy, so values returned by CachedConversation are safe to read at any time.
+ */
+
+// Return the last known state of a conversation, or nil if it hasn't been seen.
+func (c *Client) CachedConversation(conversationId string) *hangouts.Conversation {
+	c.conversationsLock.RLock()
+	defer c.conversationsLock.RUnlock()
+	return c.conversations[conversationId]
+}
+
+// Return the last known state of all conversations seen so far.
+func (c *Client) CachedConversations() []*hangouts.Conversation {
+	c.conversationsLock.RLock()
+	defer c.conversationsLock.RUnlock()
+	conversations := make([]*hangouts.Conversation, 0, len(c.conversations))
+	for _, conversation := range c.conversations {
+		conversations = append(conversations, conversation)
+	}
+	return conversations
+}
+
+func (c *Client) cacheConversation(conversation *hangouts.Conversation) {
+	if conversation == nil || conversation.ConversationId == nil {
+		return
+	}
+	c.conversationsLock.Lock()
+	defer c.conversationsLock.Unlock()
+	if c.conversations == nil {
+		c.conversations = make(map[string]*hangouts.Conversation)
+	}
+	c.conversations[conversation.ConversationId.GetId()] = conversation
+}
+
+func (c *Client) cacheConversationStates(conversationStates []*hangouts.ConversationState) {
+	for _, conversationState := range conversationStates {
+		c.cacheConversation(conversationState.Conversation)
+	}
+}
+
+// updateCachedConversation applies modify to a copy of the cached conversation
+// and stores the copy. It does nothing if the conversation isn't cached.
+func (c *Client) updateCachedConversation(conversationId string, modify func(*hangouts.Conversation)) {
+	c.conversationsLock.Lock()
+	defer c.conversationsLock.Unlock()
+	cached, found := c.conversations[conversationId]
+	if !found {
+		return
+	}
+	conversation := proto.Clone(cached).(*hangouts.Conversation)
+	modify(conversation)
+	c.conversations[conversationId] = conversation
+}
+
+// Replace the view (inbox/archived) of a cached conversation.
+func (c *Client) setCachedConversationView(conversationId string, view hangouts.ConversationView) {
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		if conversation.SelfConversationState == nil {
+			conversation.SelfConversationState = &hangouts.UserConversationState{}
+		}
+		conversation.SelfConversationState.View = []hangouts.ConversationView{view}
+	})
+}
+
+// Replace the off-the-record status of a cached conversation.
+func (c *Client) setCachedConversationOtrStatus(conversationId string, otrStatus hangouts.OffTheRecordStatus) {
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		conversation.OtrStatus = &otrStatus
+	})
+}
+
+// Replace the name of a cached conversation after a rename event.
+func (c *Client) setCachedConversationName(conversationId, name string) {
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		conversation.Name = &name
+	})
+}
+
+// Add or remove current participants of a cached conversation after a
+// membership change event. Joined users get participant data, without a
+// name, until the next sync brings theirs.
+func (c *Client) setCachedConversationMembership(conversationId string, change *hangouts.MembershipChange) {
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		participants := make([]*hangouts.ParticipantId, 0, len(conversation.CurrentParticipant))
+		changed := make(map[string]bool)
+		for _, participantId := range change.ParticipantIds {
+			changed[participantId.GetGaiaId()] = true
+		}
+		for _, participantId := range conversation.CurrentParticipant {
+			if !changed[participantId.GetGaiaId()] {
+				participants = append(participants, participantId)
+			}
+		}
+		if change.GetType() == hangouts.MembershipChangeType_MEMBERSHIP_CHANGE_TYPE_JOIN {
+			participants = append(participants, change.ParticipantIds...)
+			known := make(map[string]bool)
+			for _, participantData := range conversation.ParticipantData {
+				known[participantData.Id.GetGaiaId()] = true
+			}
+			for _, participantId := range change.ParticipantIds {
+				if !known[participantId.GetGaiaId()] {
+					known[participantId.GetGaiaId()] = true
+					conversation.ParticipantData = append(conversation.ParticipantData,
+						&hangouts.ConversationParticipantData{Id: participantId})
+				}
+			}
+		}
+		conversation.CurrentParticipant = participants
+	})
+}
+
+// Move the sort timestamp of a cached conversation forward to timestamp.
+func (c *Client) advanceCachedConversationSortTimestamp(conversationId string, timestamp uint64) {
+	if conversation := c.CachedConversation(conversationId); conversation.GetSelfConversationState().GetSortTimestamp() >= timestamp {
+		return
+	}
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		if conversation.SelfConversationState == nil {
+			conversation.SelfConversationState = &hangouts.UserConversationState{}
+		}
+		conversation.SelfConversationState.SortTimestamp = &timestamp
+	})
+}
+
+// Record that a participant has read a cached conversation up to timestamp.
+// Watermarks only move forward.
+func (c *Client) setCachedConversationWatermark(conversationId, gaiaId string, timestamp uint64) {
+	selfId := ""
+	if self := c.SelfEntity(); self != nil {
+		selfId = self.Id.GetGaiaId()
+	}
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		if selfId == "" {
+			selfId = conversation.GetSelfConversationState().GetSelfReadState().GetParticipantId().GetGaiaId()
+		}
+		found := false
+		for _, readState := range conversation.ReadState {
+			if readState.ParticipantId.GetGaiaId() == gaiaId {
+				found = true
+				if readState.GetLatestReadTimestamp() < timestamp {
+					readState.LatestReadTimestamp = &timestamp
+				}
+			}
+		}
+		if !found {
+			conversation.ReadState = append(conversation.ReadState, &hangouts.UserReadState{
+				ParticipantId:       &hangouts.ParticipantId{GaiaId: &gaiaId, ChatId: &gaiaId},
+				LatestReadTimestamp: &timestamp,
+			})
+		}
+		if gaiaId == selfId {
+			if conversation.SelfConversationState == nil {
+				conversation.SelfConversationState = &hangouts.UserConversationState{}
+			}
+			selfReadState := conversation.SelfConversationState.SelfReadState
+			if selfReadState == nil {
+				selfReadState = &hangouts.UserReadState{ParticipantId: &hangouts.ParticipantId{GaiaId: &gaiaId, ChatId: &gaiaId}}
+				conversation.SelfConversationState.SelfReadState = selfReadState
+			}
+			if selfReadState.GetLatestReadTimestamp() < timestamp {
+				selfReadState.LatestReadTimestamp = &timestamp
+			}
+		}
+	})
+}
+
+// Replace the notification level of a cached conversation.
+func (c *Client) setCachedConversationNotificationLevel(conversationId string, level hangouts.NotificationLevel) {
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		if conversation.SelfConversationState == nil {
+			conversation.SelfConversationState = &hangouts.UserConversationState{}
+		}
+		conversation.SelfConversationState.NotificationLevel = &level
+	})
+}
+
+// Forget a conversation, after it was deleted.
+func (c *Client) uncacheConversation(conversationId string) {
+	c.conversationsLock.Lock()
+	defer c.conversationsLock.Unlock()
+	delete(c.conversations, conversationId)
+}
+
+// Report whether a conversation is known to be off the record (history
+// disabled). Unknown conversations are assumed to be on the record.
+func (c *Client) IsOffTheRecord(conversationId string) bool {
+	conversation := c.CachedConversation(conversationId)
+	return conversation.GetOtrStatus() == hangouts.OffTheRecordStatus_OFF_THE_RECORD_STATUS_OFF_THE_RECORD
+}
+
+// Timestamp of the latest event in a conversation, as far as we know.
+// Falls back to the current time when the conversation hasn't been seen.
+func (c *Client) lastEventTimestamp(conversationId string) uint64 {
+	conversation := c.CachedConversation(conversationId)
+	if conversation != nil && conversation.SelfConversationState.GetSortTimestamp() != 0 {
+		return conversation.SelfConversationState.GetSortTimestamp()
+	}
+	return uint64(time.Now().UnixNano() / 1000)
+}
+
+// Return the current user as last returned by GetSelfInfo, nil before that.
+func (c *Client) SelfEntity() *hangouts.Entity {
+	c.selfEntityLock.RLock()
+	defer c.selfEntityLock.RUnlock()
+	return c.selfEntity
+}
+
+func (c *Client) setSelfEntity(entity *hangouts.Entity) {
+	if entity == nil {
+		return
+	}
+	c.selfEntityLock.Lock()
+	defer c.selfEntityLock.Unlock()
+	c.selfEntity = entity
+}
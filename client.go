@@ -4,8 +4,10 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
-	"net/url"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -15,6 +17,31 @@ import (
 type Client struct {
 	Session  *Session
 	ClientId string
+
+	// resumable upload endpoint used by UploadImage, DefaultImageUploadUrl
+	// when unset
+	ImageUploadUrl string
+	// http client for uploads and media downloads, http.DefaultClient when unset
+	HttpClient *http.Client
+
+	// conversations seen in api responses, keyed by conversation id
+	conversations     map[string]*hangouts.Conversation
+	conversationsLock sync.RWMutex
+
+	// gaia ids of users known to be blocked
+	blockedUsers     map[string]bool
+	blockedUsersLock sync.RWMutex
+
+	// delivery mediums chosen with SetDeliveryMedium, keyed by conversation id
+	deliveryMediums     map[string]*hangouts.DeliveryMedium
+	deliveryMediumsLock sync.RWMutex
+
+	// the current user, from GetSelfInfo
+	selfEntity     *hangouts.Entity
+	selfEntityLock sync.RWMutex
+
+	handlers     []*stateUpdateHandlerEntry
+	handlersLock sync.RWMutex
 }
 
 // initialize random number generator needed for client id
@@ -43,7 +70,6 @@ func (c *Client) NewEventRequestHeaders(conversationId string, offTheRecord bool
 	if offTheRecord {
 		expectedOtr = hangouts.OffTheRecordStatus_OFF_THE_RECORD_STATUS_OFF_THE_RECORD
 	}
-	deliveryMedium := hangouts.DeliveryMediumType_DELIVERY_MEDIUM_BABEL
 	// needs to be unique every time
 	clientGeneratedId := uint64(rand.Uint32())
 	eventType := hangouts.EventType_EVENT_TYPE_REGULAR_CHAT_MESSAGE
@@ -51,7 +77,7 @@ func (c *Client) NewEventRequestHeaders(conversationId string, offTheRecord bool
 		ConversationId:    &hangouts.ConversationId{Id: &conversationId},
 		ClientGeneratedId: &clientGeneratedId,
 		ExpectedOtr:       &expectedOtr,
-		DeliveryMedium:    &hangouts.DeliveryMedium{MediumType: &deliveryMedium},
+		DeliveryMedium:    c.DeliveryMedium(conversationId),
 		EventType:         &eventType,
 	}
 }
@@ -84,6 +110,27 @@ func (c *Client) ProtobufApiRequest(apiEndpoint string, requestStruct, responseS
 	return nil
 }
 
+// Build a request carrying the session cookies and auth headers, for
+// endpoints outside the protobuf api (uploads, media downloads).
+func (c *Client) newAuthenticatedRequest(method, endpointUrl string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, endpointUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	for headerKey, headerVal := range GetAuthHeaders(c.Session.Sapisid) {
+		req.Header.Set(headerKey, headerVal)
+	}
+	req.Header.Set("cookie", c.Session.Cookies)
+	return req, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HttpClient != nil {
+		return c.HttpClient
+	}
+	return http.DefaultClient
+}
+
 /*
 * Api WrapperMethods
 *
@@ -93,14 +140,14 @@ func (c *Client) ProtobufApiRequest(apiEndpoint string, requestStruct, responseS
 //Invite users to join an existing group conversation.
 func (c *Client) AddUser(inviteesGaiaIds []string, conversationId string) (*hangouts.AddUserResponse, error) {
 	inviteeIds := make([]*hangouts.InviteeID, len(inviteesGaiaIds))
-	for ind, gaiaId := range inviteesGaiaIds {
-		inviteeIds[ind] = &hangouts.InviteeID{GaiaId: &gaiaId}
+	for ind := range inviteesGaiaIds {
+		inviteeIds[ind] = &hangouts.InviteeID{GaiaId: &inviteesGaiaIds[ind]}
 	}
 
 	request := &hangouts.AddUserRequest{
 		RequestHeader:      c.NewRequestHeaders(),
 		InviteeId:          inviteeIds,
-		EventRequestHeader: c.NewEventRequestHeaders(conversationId, false),
+		EventRequestHeader: c.NewEventRequestHeaders(conversationId, c.IsOffTheRecord(conversationId)),
 	}
 	response := &hangouts.AddUserResponse{}
 	err := c.ProtobufApiRequest("conversations/adduser", request, response)
@@ -110,6 +157,11 @@ func (c *Client) AddUser(inviteesGaiaIds []string, conversationId string) (*hang
 	return response, nil
 }
 
+// Move a conversation to the archive.
+func (c *Client) ArchiveConversation(conversationId string) (*hangouts.ModifyConversationViewResponse, error) {
+	return c.ModifyConversationView(conversationId, hangouts.ConversationView_CONVERSATION_VIEW_ARCHIVED, c.lastEventTimestamp(conversationId))
+}
+
 //Create a new conversation.
 func (c *Client) CreateConversation(inviteesGaiaIds []string, name string, oneOnOne bool) (*hangouts.CreateConversationResponse, error) {
 	inviteeIds := make([]*hangouts.InviteeID, len(inviteesGaiaIds))
@@ -134,6 +186,7 @@ func (c *Client) CreateConversation(inviteesGaiaIds []string, name string, oneOn
 	if err != nil {
 		return nil, err
 	}
+	c.cacheConversation(response.Conversation)
 	return response, nil
 }
 
@@ -158,7 +211,11 @@ func (c *Client) DeleteConversation(conversationId string, deleteUpperBoundTimes
 }
 
 // Send an easter egg event to a conversation.
+// message must be one of the known easter eggs, see EasterEggName.
 func (c *Client) EasterEgg(conversationId string, message string) (*hangouts.EasterEggResponse, error) {
+	if !EasterEggName(message).Valid() {
+		return nil, fmt.Errorf("Unknown easter egg %q", message)
+	}
 	request := &hangouts.EasterEggRequest{
 		RequestHeader:  c.NewRequestHeaders(),
 		ConversationId: &hangouts.ConversationId{Id: &conversationId},
@@ -185,14 +242,39 @@ func (c *Client) GetConversation(conversationId string, includeEvent bool, maxEv
 	if err != nil {
 		return nil, err
 	}
+	if response.ConversationState != nil {
+		c.cacheConversation(response.ConversationState.Conversation)
+	}
+	return response, nil
+}
+
+// Return events of a conversation older than the continuation token.
+// A nil token returns the latest events.
+func (c *Client) GetConversationEvents(conversationId string, maxEvents uint64, continuationToken *hangouts.EventContinuationToken) (*hangouts.GetConversationResponse, error) {
+	includeEvent := true
+	request := &hangouts.GetConversationRequest{
+		RequestHeader:            c.NewRequestHeaders(),
+		ConversationSpec:         &hangouts.ConversationSpec{ConversationId: &hangouts.ConversationId{Id: &conversationId}},
+		IncludeEvent:             &includeEvent,
+		MaxEventsPerConversation: &maxEvents,
+		EventContinuationToken:   continuationToken,
+	}
+	response := &hangouts.GetConversationResponse{}
+	err := c.ProtobufApiRequest("conversations/getconversation", request, response)
+	if err != nil {
+		return nil, err
+	}
+	if response.ConversationState != nil {
+		c.cacheConversation(response.ConversationState.Conversation)
+	}
 	return response, nil
 }
 
 // Return info about a list of users.
 func (c *Client) GetEntityById(gaiaIds []string) (*hangouts.GetEntityByIdResponse, error) {
 	batchLookupSpec := make([]*hangouts.EntityLookupSpec, len(gaiaIds))
-	for ind, gaiaId := range gaiaIds {
-		batchLookupSpec[ind] = &hangouts.EntityLookupSpec{GaiaId: &gaiaId}
+	for ind := range gaiaIds {
+		batchLookupSpec[ind] = &hangouts.EntityLookupSpec{GaiaId: &gaiaIds[ind]}
 	}
 	request := &hangouts.GetEntityByIdRequest{
 		RequestHeader:   c.NewRequestHeaders(),
@@ -216,6 +298,50 @@ func (c *Client) GetSelfInfo() (*hangouts.GetSelfInfoResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.setSelfEntity(response.SelfEntity)
+	return response, nil
+}
+
+// Move a conversation between the inbox and the archive.
+// lastEventTimestamp is the timestamp of the latest event the client knows of.
+func (c *Client) ModifyConversationView(conversationId string, newView hangouts.ConversationView, lastEventTimestamp uint64) (*hangouts.ModifyConversationViewResponse, error) {
+	request := &hangouts.ModifyConversationViewRequest{
+		RequestHeader:      c.NewRequestHeaders(),
+		ConversationId:     &hangouts.ConversationId{Id: &conversationId},
+		NewView:            &newView,
+		LastEventTimestamp: &lastEventTimestamp,
+	}
+	response := &hangouts.ModifyConversationViewResponse{}
+	err := c.ProtobufApiRequest("conversations/modifyconversationview", request, response)
+	if err != nil {
+		return nil, err
+	}
+	c.setCachedConversationView(conversationId, newView)
+	return response, nil
+}
+
+// Turn conversation history off (offTheRecord=true) or back on.
+func (c *Client) ModifyOTRStatus(conversationId string, offTheRecord bool) (*hangouts.ModifyOTRStatusResponse, error) {
+	otrStatus := hangouts.OffTheRecordStatus_OFF_THE_RECORD_STATUS_ON_THE_RECORD
+	if offTheRecord {
+		otrStatus = hangouts.OffTheRecordStatus_OFF_THE_RECORD_STATUS_OFF_THE_RECORD
+	}
+	// expected_otr has to match the status before the change
+	eventRequestHeader := c.NewEventRequestHeaders(conversationId, c.IsOffTheRecord(conversationId))
+	eventType := hangouts.EventType_EVENT_TYPE_OTR_MODIFICATION
+	eventRequestHeader.EventType = &eventType
+
+	request := &hangouts.ModifyOTRStatusRequest{
+		RequestHeader:      c.NewRequestHeaders(),
+		OtrStatus:          &otrStatus,
+		EventRequestHeader: eventRequestHeader,
+	}
+	response := &hangouts.ModifyOTRStatusResponse{}
+	err := c.ProtobufApiRequest("conversations/modifyotrstatus", request, response)
+	if err != nil {
+		return nil, err
+	}
+	c.setCachedConversationOtrStatus(conversationId, otrStatus)
 	return response, nil
 }
 
@@ -229,7 +355,12 @@ func (c *Client) QueryPresence(gaiaId string) (*hangouts.QueryPresenceResponse,
 	request := &hangouts.QueryPresenceRequest{
 		RequestHeader: c.NewRequestHeaders(),
 		ParticipantId: []*hangouts.ParticipantId{&hangouts.ParticipantId{GaiaId: &gaiaId, ChatId: &gaiaId}},
-		FieldMask:     []hangouts.FieldMask{hangouts.FieldMask_FIELD_MASK_REACHABLE, hangouts.FieldMask_FIELD_MASK_AVAILABLE, hangouts.FieldMask_FIELD_MASK_DEVICE},
+		FieldMask: []hangouts.FieldMask{
+			hangouts.FieldMask_FIELD_MASK_REACHABLE,
+			hangouts.FieldMask_FIELD_MASK_AVAILABLE,
+			hangouts.FieldMask_FIELD_MASK_MOOD,
+			hangouts.FieldMask_FIELD_MASK_DEVICE,
+		},
 	}
 	response := &hangouts.QueryPresenceResponse{}
 	err := c.ProtobufApiRequest("presence/querypresence", request, response)
@@ -243,7 +374,7 @@ func (c *Client) QueryPresence(gaiaId string) (*hangouts.QueryPresenceResponse,
 func (c *Client) RemoveUser(conversationId string) (*hangouts.RemoveUserResponse, error) {
 	request := &hangouts.RemoveUserRequest{
 		RequestHeader:      c.NewRequestHeaders(),
-		EventRequestHeader: c.NewEventRequestHeaders(conversationId, false),
+		EventRequestHeader: c.NewEventRequestHeaders(conversationId, c.IsOffTheRecord(conversationId)),
 	}
 	response := &hangouts.RemoveUserResponse{}
 	err := c.ProtobufApiRequest("conversations/removeuser", request, response)
@@ -262,7 +393,7 @@ func (c *Client) RemoveUser(conversationId string) (*hangouts.RemoveUserResponse
 func (c *Client) RenameConversation(conversationId, newName string) (*hangouts.RenameConversationResponse, error) {
 	request := &hangouts.RenameConversationRequest{
 		RequestHeader:      c.NewRequestHeaders(),
-		EventRequestHeader: c.NewEventRequestHeaders(conversationId, false),
+		EventRequestHeader: c.NewEventRequestHeaders(conversationId, c.IsOffTheRecord(conversationId)),
 		NewName:            &newName,
 	}
 	response := &hangouts.RenameConversationResponse{}
@@ -273,6 +404,26 @@ func (c *Client) RenameConversation(conversationId, newName string) (*hangouts.R
 	return response, nil
 }
 
+// Accept or decline an invitation to a conversation.
+func (c *Client) ReplyToInvite(conversationId string, accept bool) (*hangouts.ReplyToInviteResponse, error) {
+	replyType := hangouts.ReplyToInviteType_REPLY_TO_INVITE_TYPE_DECLINE
+	if accept {
+		replyType = hangouts.ReplyToInviteType_REPLY_TO_INVITE_TYPE_ACCEPT
+	}
+	request := &hangouts.ReplyToInviteRequest{
+		RequestHeader:     c.NewRequestHeaders(),
+		ConversationId:    &hangouts.ConversationId{Id: &conversationId},
+		ReplyToInviteType: &replyType,
+	}
+	response := &hangouts.ReplyToInviteResponse{}
+	err := c.ProtobufApiRequest("conversations/replytoinvite", request, response)
+	if err != nil {
+		return nil, err
+	}
+	c.setCachedConversationInviteReply(conversationId, replyType)
+	return response, nil
+}
+
 // Return info for users based on a query.
 func (c *Client) SearchEntities(query string, maxCount uint64) (*hangouts.SearchEntitiesResponse, error) {
 	request := &hangouts.SearchEntitiesRequest{
@@ -288,41 +439,38 @@ func (c *Client) SearchEntities(query string, maxCount uint64) (*hangouts.Search
 	return response, nil
 }
 
+// Send a "/me" action, shown by clients as the sender's name followed by
+// text. A leading "/me " in text is dropped.
+func (c *Client) SendAction(conversationId, text string) (*hangouts.SendChatMessageResponse, error) {
+	if action, ok := ParseAction(text); ok {
+		text = action
+	}
+	messageContent := NewMessageBuilder().Text(text).MessageContent()
+	return c.sendChatMessage(conversationId, messageContent, []*hangouts.EventAnnotation{NewActionAnnotation()}, nil)
+}
+
 // Send a chat message to a conversation.
+// Newlines become line breaks and urls become links, use SendMessage with a
+// MessageBuilder for more control.
 func (c *Client) SendChatMessage(conversationId, message string) (*hangouts.SendChatMessageResponse, error) {
-	// for now treat message as one segment
-	// TODO split it on TEXT, LINE_BREAK and LINK
-	segmentType := hangouts.SegmentType_SEGMENT_TYPE_TEXT
-
-	linkData := &hangouts.LinkData{}
-	// check if it is a link
-	_, err := url.Parse(message)
-	if err == nil {
-		segmentType = hangouts.SegmentType_SEGMENT_TYPE_LINK
-		linkData.LinkTarget = &message
-	}
-
-	messageContent := &hangouts.MessageContent{
-		Segment: []*hangouts.Segment{
-			&hangouts.Segment{
-				Type:       &segmentType,
-				Text:       &message,
-				Formatting: &hangouts.Formatting{},
-				LinkData:   linkData,
-			},
-		},
-		Attachment: nil,
-	}
+	return c.SendMessage(conversationId, NewMessageBuilder().Text(message).MessageContent())
+}
+
+// Send message content (see MessageBuilder) to a conversation.
+func (c *Client) SendMessage(conversationId string, messageContent *hangouts.MessageContent) (*hangouts.SendChatMessageResponse, error) {
+	return c.sendChatMessage(conversationId, messageContent, nil, nil)
+}
 
+func (c *Client) sendChatMessage(conversationId string, messageContent *hangouts.MessageContent, annotations []*hangouts.EventAnnotation, existingMedia *hangouts.ExistingMedia) (*hangouts.SendChatMessageResponse, error) {
 	request := &hangouts.SendChatMessageRequest{
 		RequestHeader:      c.NewRequestHeaders(),
-		EventRequestHeader: c.NewEventRequestHeaders(conversationId, false),
+		EventRequestHeader: c.NewEventRequestHeaders(conversationId, c.IsOffTheRecord(conversationId)),
 		MessageContent:     messageContent,
-		//Annotation: [],
-		//ExistingMedia: &hangouts.ExistingMedia{Photo: &hangouts.Photo{}}, //picassa photos
+		Annotation:         annotations,
+		ExistingMedia:      existingMedia,
 	}
 	response := &hangouts.SendChatMessageResponse{}
-	err = c.ProtobufApiRequest("conversations/sendchatmessage", request, response)
+	err := c.ProtobufApiRequest("conversations/sendchatmessage", request, response)
 	if err != nil {
 		return nil, err
 	}
@@ -347,13 +495,27 @@ func (c *Client) SendOffnetworkInvitation(email string) (*hangouts.SendOffnetwor
 	return response, nil
 }
 
+// Send a photo uploaded with UploadImage, with an optional message.
+func (c *Client) SendPhoto(conversationId, photoId string, messageContent *hangouts.MessageContent) (*hangouts.SendChatMessageResponse, error) {
+	if photoId == "" {
+		return nil, errors.New("Can't send a photo without a photo id")
+	}
+	existingMedia := &hangouts.ExistingMedia{Photo: &hangouts.Photo{PhotoId: &photoId}}
+	return c.sendChatMessage(conversationId, messageContent, nil, existingMedia)
+}
+
 // Set the active client.
 // timeout is 120 secs in hangups
 func (c *Client) SetActiveClient(email string, isActive bool, timeoutSecs uint64) (*hangouts.SetActiveClientResponse, error) {
-	if c.ClientId == "" {
+	return c.setActiveClient(email, c.ClientId, isActive, timeoutSecs)
+}
+
+// Set the active client under the given client id rather than ClientId.
+func (c *Client) setActiveClient(email, clientId string, isActive bool, timeoutSecs uint64) (*hangouts.SetActiveClientResponse, error) {
+	if clientId == "" {
 		return nil, errors.New("Can't set active client without a ClientId")
 	}
-	emailAndResource := fmt.Sprintf("%s/%s", email, c.ClientId)
+	emailAndResource := fmt.Sprintf("%s/%s", email, clientId)
 
 	request := &hangouts.SetActiveClientRequest{
 		RequestHeader: c.NewRequestHeaders(),
@@ -369,6 +531,29 @@ func (c *Client) SetActiveClient(email string, isActive bool, timeoutSecs uint64
 	return response, nil
 }
 
+// Block or unblock a user.
+func (c *Client) SetBlockState(gaiaId string, block bool) (*hangouts.SetBlockStateResponse, error) {
+	blockState := hangouts.BlockState_BLOCK_STATE_UNBLOCK
+	if block {
+		blockState = hangouts.BlockState_BLOCK_STATE_BLOCK
+	}
+	blockStateChange := &hangouts.BlockStateChange{
+		ParticipantId: &hangouts.ParticipantId{GaiaId: &gaiaId, ChatId: &gaiaId},
+		NewBlockState: &blockState,
+	}
+	request := &hangouts.SetBlockStateRequest{
+		RequestHeader:    c.NewRequestHeaders(),
+		BlockStateChange: blockStateChange,
+	}
+	response := &hangouts.SetBlockStateResponse{}
+	err := c.ProtobufApiRequest("contacts/setblockstate", request, response)
+	if err != nil {
+		return nil, err
+	}
+	c.setBlockStates([]*hangouts.BlockStateChange{blockStateChange})
+	return response, nil
+}
+
 // Set the notification level of a conversation.
 func (c *Client) SetConversationNotificationLevel(conversationId string, setQuiet bool) (*hangouts.SetConversationNotificationLevelResponse, error) {
 	notificationLevel := hangouts.NotificationLevel_NOTIFICATION_LEVEL_RING
@@ -454,6 +639,7 @@ func (c *Client) SyncAllNewEvents(lastSyncTimestamp, maxResponseSizeBytes uint64
 	if err != nil {
 		return nil, err
 	}
+	c.cacheConversationStates(response.ConversationState)
 	return response, nil
 }
 
@@ -470,9 +656,15 @@ func (c *Client) SyncRecentConversations(maxConversations, maxEventsPerConversat
 	if err != nil {
 		return nil, err
 	}
+	c.cacheConversationStates(response.ConversationState)
 	return response, nil
 }
 
+// Move an archived conversation back to the inbox.
+func (c *Client) UnarchiveConversation(conversationId string) (*hangouts.ModifyConversationViewResponse, error) {
+	return c.ModifyConversationView(conversationId, hangouts.ConversationView_CONVERSATION_VIEW_INBOX, c.lastEventTimestamp(conversationId))
+}
+
 // Update the watermark (read timestamp) of a conversation.
 func (c *Client) UpdateWatermark(conversationId string, lastReadTimestamp uint64) (*hangouts.UpdateWatermarkResponse, error) {
 	request := &hangouts.UpdateWatermarkRequest{
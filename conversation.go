@@ -0,0 +1,353 @@
+package hangups
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Conversation
+*
+* Conversation binds a conversation id to a Client. Its state is read from
+* the client's conversation cache, and its methods feed the events the
+* server creates in response back into that cache, so name, otr status,
+* participants and read state stay current without waiting for the
+* matching StateUpdates.
+ */
+
+// Default number of events a Conversation keeps, see
+// ConversationListOptions.MaxEvents.
+const DefaultMaxConversationEvents = 200
+
+// A conversation, bound to a Client. Get one from a ConversationList or
+// with Client.Conversation.
+type Conversation struct {
+	client *Client
+	id     string
+
+	maxEvents  int
+	events     []*hangouts.Event
+	eventsLock sync.RWMutex
+
+	// where History continues, nil to start before the oldest event
+	historyToken *hangouts.EventContinuationToken
+	// set once the server returned the oldest events
+	historyDone bool
+}
+
+// Return a Conversation for a conversation id. Unlike the conversations of a
+// ConversationList it only learns of events through its own methods.
+func (c *Client) Conversation(conversationId string) *Conversation {
+	return &Conversation{client: c, id: conversationId, maxEvents: DefaultMaxConversationEvents}
+}
+
+// Return the conversation id.
+func (conv *Conversation) Id() string {
+	return conv.id
+}
+
+// Return the last known state of the conversation, nil if only its events
+// have been seen so far.
+func (conv *Conversation) State() *hangouts.Conversation {
+	return conv.client.CachedConversation(conv.id)
+}
+
+// Return the conversation's name, "" for conversations without one.
+func (conv *Conversation) Name() string {
+	return conv.State().GetName()
+}
+
+// Report whether the conversation is off the record.
+func (conv *Conversation) IsOffTheRecord() bool {
+	return conv.client.IsOffTheRecord(conv.id)
+}
+
+// Return the timestamp conversations are sorted by, in microseconds.
+func (conv *Conversation) SortTimestamp() uint64 {
+	return conv.State().GetSelfConversationState().GetSortTimestamp()
+}
+
+// Report whether the conversation is archived.
+func (conv *Conversation) IsArchived() bool {
+	for _, view := range conv.State().GetSelfConversationState().GetView() {
+		if view == hangouts.ConversationView_CONVERSATION_VIEW_ARCHIVED {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the participant data of the current participants.
+func (conv *Conversation) Participants() []*hangouts.ConversationParticipantData {
+	state := conv.State()
+	current := make(map[string]bool)
+	for _, participantId := range state.GetCurrentParticipant() {
+		current[participantId.GetGaiaId()] = true
+	}
+	participants := make([]*hangouts.ConversationParticipantData, 0, len(current))
+	for _, participantData := range state.GetParticipantData() {
+		if current[participantData.Id.GetGaiaId()] {
+			participants = append(participants, participantData)
+		}
+	}
+	return participants
+}
+
+// Return the number of known message events newer than the self user's
+// watermark, not counting the self user's own. Only events the conversation
+// keeps (see Events) are counted.
+func (conv *Conversation) UnreadCount() int {
+	selfState := conv.State().GetSelfConversationState()
+	readTimestamp := selfState.GetSelfReadState().GetLatestReadTimestamp()
+	selfId := selfState.GetSelfReadState().GetParticipantId().GetGaiaId()
+	if self := conv.client.SelfEntity(); self != nil {
+		selfId = self.Id.GetGaiaId()
+	}
+	unread := 0
+	for _, event := range conv.Events() {
+		if IsMessageEvent(event) && event.GetTimestamp() > readTimestamp && event.SenderId.GetGaiaId() != selfId {
+			unread++
+		}
+	}
+	return unread
+}
+
+// Return the timestamp up to which a participant has read the
+// conversation, 0 if unknown.
+func (conv *Conversation) ReadTimestamp(gaiaId string) uint64 {
+	state := conv.State()
+	selfReadState := state.GetSelfConversationState().GetSelfReadState()
+	if selfReadState.GetParticipantId().GetGaiaId() == gaiaId && gaiaId != "" {
+		return selfReadState.GetLatestReadTimestamp()
+	}
+	for _, readState := range state.GetReadState() {
+		if readState.ParticipantId.GetGaiaId() == gaiaId {
+			return readState.GetLatestReadTimestamp()
+		}
+	}
+	return 0
+}
+
+// Return the gaia ids of the participants that have read an event, by
+// their watermarks. The sender and the self user are left out.
+func (conv *Conversation) SeenBy(event *hangouts.Event) []string {
+	selfId := conv.State().GetSelfConversationState().GetSelfReadState().GetParticipantId().GetGaiaId()
+	if self := conv.client.SelfEntity(); self != nil {
+		selfId = self.Id.GetGaiaId()
+	}
+	seenBy := make([]string, 0)
+	for _, readState := range conv.State().GetReadState() {
+		gaiaId := readState.ParticipantId.GetGaiaId()
+		if gaiaId == selfId || gaiaId == event.SenderId.GetGaiaId() {
+			continue
+		}
+		if readState.GetLatestReadTimestamp() >= event.GetTimestamp() {
+			seenBy = append(seenBy, gaiaId)
+		}
+	}
+	sort.Strings(seenBy)
+	return seenBy
+}
+
+// Return the known events of the conversation, oldest first.
+func (conv *Conversation) Events() []*hangouts.Event {
+	conv.eventsLock.RLock()
+	defer conv.eventsLock.RUnlock()
+	events := make([]*hangouts.Event, len(conv.events))
+	copy(events, conv.events)
+	return events
+}
+
+// Return the latest known event of the conversation, nil if none is known.
+func (conv *Conversation) LastEvent() *hangouts.Event {
+	conv.eventsLock.RLock()
+	defer conv.eventsLock.RUnlock()
+	if len(conv.events) == 0 {
+		return nil
+	}
+	return conv.events[len(conv.events)-1]
+}
+
+// Send message content (see MessageBuilder) and return the created event.
+func (conv *Conversation) Send(messageContent *hangouts.MessageContent) (*hangouts.Event, error) {
+	response, err := conv.client.SendMessage(conv.id, messageContent)
+	if err != nil {
+		return nil, err
+	}
+	conv.applyEvent(response.CreatedEvent)
+	return response.CreatedEvent, nil
+}
+
+// Rename the conversation.
+func (conv *Conversation) Rename(name string) error {
+	response, err := conv.client.RenameConversation(conv.id, name)
+	if err != nil {
+		return err
+	}
+	conv.applyEvent(response.CreatedEvent)
+	return nil
+}
+
+// Invite users to the conversation.
+func (conv *Conversation) AddUsers(gaiaIds ...string) error {
+	response, err := conv.client.AddUser(gaiaIds, conv.id)
+	if err != nil {
+		return err
+	}
+	conv.applyEvent(response.CreatedEvent)
+	return nil
+}
+
+// Leave the conversation. One-to-one conversations can't be left, so their
+// history is deleted instead, which hides them until a new message arrives.
+func (conv *Conversation) Leave() error {
+	if conv.State().GetType() == hangouts.ConversationType_CONVERSATION_TYPE_ONE_TO_ONE {
+		_, err := conv.client.DeleteConversation(conv.id, conv.client.lastEventTimestamp(conv.id))
+		if err != nil {
+			return err
+		}
+		conv.client.uncacheConversation(conv.id)
+		return nil
+	}
+	response, err := conv.client.RemoveUser(conv.id)
+	if err != nil {
+		return err
+	}
+	conv.applyEvent(response.CreatedEvent)
+	return nil
+}
+
+// Set the notification level, NOTIFICATION_LEVEL_QUIET or NOTIFICATION_LEVEL_RING.
+func (conv *Conversation) SetNotificationLevel(level hangouts.NotificationLevel) error {
+	if level != hangouts.NotificationLevel_NOTIFICATION_LEVEL_QUIET && level != hangouts.NotificationLevel_NOTIFICATION_LEVEL_RING {
+		return errors.New("Can't set notification level " + level.String())
+	}
+	_, err := conv.client.SetConversationNotificationLevel(conv.id, level == hangouts.NotificationLevel_NOTIFICATION_LEVEL_QUIET)
+	if err != nil {
+		return err
+	}
+	conv.client.setCachedConversationNotificationLevel(conv.id, level)
+	return nil
+}
+
+// Set the self user's typing status in the conversation.
+func (conv *Conversation) SetTyping(typing hangouts.TypingType) error {
+	_, err := conv.client.SetTyping(conv.id, int32(typing))
+	return err
+}
+
+// Focus or unfocus the conversation for timeoutSecs seconds.
+func (conv *Conversation) SetFocus(focused bool, timeoutSecs uint32) error {
+	_, err := conv.client.SetFocus(conv.id, !focused, timeoutSecs)
+	return err
+}
+
+// Mark the conversation as read up to its latest known event.
+func (conv *Conversation) MarkRead() error {
+	timestamp := conv.client.lastEventTimestamp(conv.id)
+	if event := conv.LastEvent(); event != nil && event.GetTimestamp() > timestamp {
+		timestamp = event.GetTimestamp()
+	}
+	_, err := conv.client.UpdateWatermark(conv.id, timestamp)
+	if err != nil {
+		return err
+	}
+	if self := conv.client.SelfEntity(); self != nil {
+		conv.client.setCachedConversationWatermark(conv.id, self.Id.GetGaiaId(), timestamp)
+	}
+	return nil
+}
+
+// Fetch up to maxEvents events older than the ones fetched so far and return
+// them, oldest first, or none once the start of the conversation was
+// reached. They are added to Events without counting against the limit on
+// the number of events the conversation keeps; newer events may push them
+// out later, which doesn't affect paging.
+func (conv *Conversation) History(maxEvents uint64) ([]*hangouts.Event, error) {
+	conv.eventsLock.RLock()
+	continuationToken, done := conv.historyToken, conv.historyDone
+	if continuationToken == nil && len(conv.events) > 0 {
+		oldest := conv.events[0].GetTimestamp()
+		continuationToken = &hangouts.EventContinuationToken{EventTimestamp: &oldest}
+	}
+	conv.eventsLock.RUnlock()
+	if done {
+		return []*hangouts.Event{}, nil
+	}
+
+	response, err := conv.client.GetConversationEvents(conv.id, maxEvents, continuationToken)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*hangouts.Event, 0)
+	for _, event := range response.ConversationState.GetEvent() {
+		if continuationToken.GetEventTimestamp() != 0 && event.GetTimestamp() >= continuationToken.GetEventTimestamp() {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.Stable(eventsByTimestamp(events))
+
+	conv.eventsLock.Lock()
+	defer conv.eventsLock.Unlock()
+	conv.historyToken = response.ConversationState.GetEventContinuationToken()
+	conv.historyDone = conv.historyToken == nil
+	for _, event := range events {
+		conv.insertEvent(event, false)
+	}
+	return events, nil
+}
+
+// Set where History continues, from the token of a synced conversation
+// state. A nil token is ignored.
+func (conv *Conversation) setHistoryToken(continuationToken *hangouts.EventContinuationToken) {
+	if continuationToken == nil {
+		return
+	}
+	conv.eventsLock.Lock()
+	defer conv.eventsLock.Unlock()
+	conv.historyToken = continuationToken
+}
+
+// Update cached state from an event the server created for a request, and
+// add it to the conversation's events.
+func (conv *Conversation) applyEvent(event *hangouts.Event) {
+	if event == nil {
+		return
+	}
+	conv.client.processEvent(event)
+	conv.addEvent(event)
+}
+
+// Add an event, keeping events sorted and dropping the oldest ones past
+// maxEvents. Returns false if the event was already known.
+func (conv *Conversation) addEvent(event *hangouts.Event) bool {
+	conv.eventsLock.Lock()
+	defer conv.eventsLock.Unlock()
+	return conv.insertEvent(event, true)
+}
+
+// Add an event, dropping the oldest events past maxEvents if trim is set.
+// The events lock must be held.
+func (conv *Conversation) insertEvent(event *hangouts.Event, trim bool) bool {
+	for _, known := range conv.events {
+		if known.GetEventId() != "" && known.GetEventId() == event.GetEventId() {
+			return false
+		}
+	}
+	conv.events = append(conv.events, event)
+	sort.Stable(eventsByTimestamp(conv.events))
+	if trim && conv.maxEvents > 0 && len(conv.events) > conv.maxEvents {
+		conv.events = conv.events[len(conv.events)-conv.maxEvents:]
+	}
+	return true
+}
+
+type eventsByTimestamp []*hangouts.Event
+
+func (e eventsByTimestamp) Len() int           { return len(e) }
+func (e eventsByTimestamp) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e eventsByTimestamp) Less(i, j int) bool { return e[i].GetTimestamp() < e[j].GetTimestamp() }
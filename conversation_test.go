@@ -0,0 +1,52 @@
+package hangups
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestConversationParticipantsAfterMembershipChanges(t *testing.T) {
+	c := &Client{}
+	c.cacheConversation(&hangouts.Conversation{
+		ConversationId:     &hangouts.ConversationId{Id: proto.String("conv")},
+		CurrentParticipant: []*hangouts.ParticipantId{{GaiaId: proto.String("1")}, {GaiaId: proto.String("2")}},
+		ParticipantData: []*hangouts.ConversationParticipantData{
+			{Id: &hangouts.ParticipantId{GaiaId: proto.String("1")}, FallbackName: proto.String("Alice")},
+			{Id: &hangouts.ParticipantId{GaiaId: proto.String("2")}, FallbackName: proto.String("Bob")},
+		},
+	})
+	conv := c.Conversation("conv")
+	membershipChange := func(changeType hangouts.MembershipChangeType, gaiaIds ...string) {
+		change := &hangouts.MembershipChange{Type: changeType.Enum()}
+		for _, gaiaId := range gaiaIds {
+			change.ParticipantIds = append(change.ParticipantIds, &hangouts.ParticipantId{GaiaId: proto.String(gaiaId)})
+		}
+		c.processEvent(&hangouts.Event{
+			ConversationId:   &hangouts.ConversationId{Id: proto.String("conv")},
+			MembershipChange: change,
+		})
+	}
+	participants := func() []string {
+		ids := make([]string, 0)
+		for _, participantData := range conv.Participants() {
+			ids = append(ids, participantData.Id.GetGaiaId()+":"+participantData.GetFallbackName())
+		}
+		return ids
+	}
+
+	membershipChange(hangouts.MembershipChangeType_MEMBERSHIP_CHANGE_TYPE_JOIN, "3")
+	if got, want := participants(), []string{"1:Alice", "2:Bob", "3:"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after a join: %v, want %v", got, want)
+	}
+	membershipChange(hangouts.MembershipChangeType_MEMBERSHIP_CHANGE_TYPE_LEAVE, "2")
+	membershipChange(hangouts.MembershipChangeType_MEMBERSHIP_CHANGE_TYPE_JOIN, "2")
+	if got, want := participants(), []string{"1:Alice", "2:Bob", "3:"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after leaving and joining again: %v, want %v", got, want)
+	}
+	if data := c.CachedConversation("conv").ParticipantData; len(data) != 3 {
+		t.Errorf("%d participant data entries, want 3", len(data))
+	}
+}
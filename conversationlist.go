@@ -0,0 +1,266 @@
+package hangups
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Conversation List
+*
+* ConversationList keeps the conversations of the current user and their
+* recent events up to date from the StateUpdates the client processes (see
+* ProcessStateUpdate). Conversation state comes from the client's
+* conversation cache, which ProcessStateUpdate maintains, so a Conversation
+* always reflects the latest renames, membership changes, watermarks, etc.
+ */
+
+// What happened to a conversation in a ConversationChange.
+type ConversationChangeType int
+
+const (
+	// The conversation was seen for the first time.
+	ConversationAdded ConversationChangeType = iota
+	// Conversation state (name, view, watermarks, etc) changed.
+	ConversationUpdated
+	// An event was added to the conversation.
+	ConversationEventAdded
+	// The conversation was deleted.
+	ConversationRemoved
+	// A participant's watermark moved, see Conversation.SeenBy and
+	// Conversation.UnreadCount.
+	ConversationRead
+)
+
+// A change to a conversation of a ConversationList.
+type ConversationChange struct {
+	Type         ConversationChangeType
+	Conversation *Conversation
+	// The new event for ConversationEventAdded, else nil.
+	Event *hangouts.Event
+	// The StateUpdate that caused the change.
+	Update *hangouts.StateUpdate
+}
+
+// Called for every change to the conversations of a ConversationList.
+type ConversationChangeHandler func(change *ConversationChange)
+
+// Options of NewConversationList.
+type ConversationListOptions struct {
+	// Number of events kept per conversation, DefaultMaxConversationEvents
+	// when zero, no limit when negative.
+	MaxEvents int
+}
+
+// The conversations of the current user, kept up to date.
+type ConversationList struct {
+	client        *Client
+	maxEvents     int
+	removeHandler func() // removes the StateUpdate handler, see Close
+
+	conversations     map[string]*Conversation
+	conversationsLock sync.RWMutex
+
+	handlers     []*ConversationChangeHandler // by pointer, so they can be removed
+	handlersLock sync.RWMutex
+}
+
+// Create a conversation list from synced conversation states (see
+// SyncRecentConversations) and keep it up to date with the StateUpdates the
+// client processes. options may be nil for the defaults.
+func NewConversationList(c *Client, conversationStates []*hangouts.ConversationState, options *ConversationListOptions) *ConversationList {
+	if options == nil {
+		options = &ConversationListOptions{}
+	}
+	list := &ConversationList{
+		client:        c,
+		maxEvents:     options.MaxEvents,
+		conversations: make(map[string]*Conversation),
+	}
+	if list.maxEvents == 0 {
+		list.maxEvents = DefaultMaxConversationEvents
+	}
+	c.cacheConversationStates(conversationStates)
+	for _, conversationState := range conversationStates {
+		conv, _ := list.conversation(conversationState.ConversationId.GetId())
+		conv.setHistoryToken(conversationState.EventContinuationToken)
+		for _, event := range conversationState.Event {
+			conv.addEvent(event)
+		}
+	}
+	list.removeHandler = c.AddStateUpdateHandler(list.processStateUpdate)
+	return list
+}
+
+// Sync recent conversations and return them as a ConversationList.
+// options may be nil for the defaults.
+func (c *Client) SyncConversationList(maxConversations, maxEventsPerConversation uint64, options *ConversationListOptions) (*ConversationList, error) {
+	response, err := c.SyncRecentConversations(maxConversations, maxEventsPerConversation)
+	if err != nil {
+		return nil, err
+	}
+	return NewConversationList(c, response.ConversationState, options), nil
+}
+
+// Register a handler to be called for every change to the list.
+// Call the returned function to remove it.
+func (list *ConversationList) AddChangeHandler(handler ConversationChangeHandler) func() {
+	entry := &handler
+	list.handlersLock.Lock()
+	defer list.handlersLock.Unlock()
+	list.handlers = append(list.handlers, entry)
+	return func() {
+		list.handlersLock.Lock()
+		defer list.handlersLock.Unlock()
+		handlers := make([]*ConversationChangeHandler, 0, len(list.handlers))
+		for _, registered := range list.handlers {
+			if registered != entry {
+				handlers = append(handlers, registered)
+			}
+		}
+		list.handlers = handlers
+	}
+}
+
+// Stop following the StateUpdates the client processes. The list keeps
+// the conversations it has.
+func (list *ConversationList) Close() {
+	list.removeHandler()
+}
+
+// Return a conversation by id, nil if it isn't in the list.
+func (list *ConversationList) Get(conversationId string) *Conversation {
+	list.conversationsLock.RLock()
+	defer list.conversationsLock.RUnlock()
+	return list.conversations[conversationId]
+}
+
+// Return all conversations, most recently active first.
+func (list *ConversationList) Conversations() []*Conversation {
+	list.conversationsLock.RLock()
+	conversations := make([]*Conversation, 0, len(list.conversations))
+	for _, conv := range list.conversations {
+		conversations = append(conversations, conv)
+	}
+	list.conversationsLock.RUnlock()
+	sort.Sort(conversationsBySortTimestamp(conversations))
+	return conversations
+}
+
+// Return the total of the unread counts of the conversations.
+func (list *ConversationList) UnreadCount() int {
+	unread := 0
+	for _, conv := range list.Conversations() {
+		unread += conv.UnreadCount()
+	}
+	return unread
+}
+
+// Return the conversations with unread messages, most recently active first.
+func (list *ConversationList) UnreadConversations() []*Conversation {
+	unread := make([]*Conversation, 0)
+	for _, conv := range list.Conversations() {
+		if conv.UnreadCount() > 0 {
+			unread = append(unread, conv)
+		}
+	}
+	return unread
+}
+
+// Return the number of conversations in the list.
+func (list *ConversationList) Len() int {
+	list.conversationsLock.RLock()
+	defer list.conversationsLock.RUnlock()
+	return len(list.conversations)
+}
+
+// Return the conversation with an id, adding it if needed. Reports
+// whether it was added.
+func (list *ConversationList) conversation(conversationId string) (*Conversation, bool) {
+	list.conversationsLock.Lock()
+	defer list.conversationsLock.Unlock()
+	if conv, found := list.conversations[conversationId]; found {
+		return conv, false
+	}
+	conv := &Conversation{client: list.client, id: conversationId, maxEvents: list.maxEvents}
+	list.conversations[conversationId] = conv
+	return conv, true
+}
+
+func (list *ConversationList) processStateUpdate(update *hangouts.StateUpdate) {
+	changes := make([]*ConversationChange, 0)
+	change := func(changeType ConversationChangeType, conv *Conversation, event *hangouts.Event) {
+		changes = append(changes, &ConversationChange{Type: changeType, Conversation: conv, Event: event, Update: update})
+	}
+	// add a conversation if needed, reporting it as added or updated
+	touch := func(conversationId string) {
+		if conversationId == "" {
+			return
+		}
+		conv, added := list.conversation(conversationId)
+		if added {
+			change(ConversationAdded, conv, nil)
+		} else {
+			change(ConversationUpdated, conv, nil)
+		}
+	}
+
+	switch {
+	case update.GetConversationNotification() != nil:
+		touch(update.GetConversationNotification().Conversation.GetConversationId().GetId())
+	case update.GetEventNotification() != nil:
+		event := update.GetEventNotification().Event
+		conv, added := list.conversation(event.ConversationId.GetId())
+		if added {
+			change(ConversationAdded, conv, nil)
+		}
+		if conv.addEvent(event) {
+			change(ConversationEventAdded, conv, event)
+		}
+	case update.GetWatermarkNotification() != nil:
+		if conv := list.Get(update.GetWatermarkNotification().ConversationId.GetId()); conv != nil {
+			change(ConversationRead, conv, nil)
+		}
+	case update.GetViewModification() != nil:
+		touch(update.GetViewModification().ConversationId.GetId())
+	case update.GetNotificationLevelNotification() != nil:
+		touch(update.GetNotificationLevelNotification().ConversationId.GetId())
+	case update.GetReplyToInviteNotification() != nil:
+		touch(update.GetReplyToInviteNotification().ConversationId.GetId())
+	case update.GetDeleteNotification() != nil:
+		notification := update.GetDeleteNotification()
+		if notification.DeleteAction.GetDeleteType() == hangouts.DeleteType_DELETE_TYPE_UPPER_BOUND {
+			conversationId := notification.ConversationId.GetId()
+			list.conversationsLock.Lock()
+			conv, found := list.conversations[conversationId]
+			delete(list.conversations, conversationId)
+			list.conversationsLock.Unlock()
+			if found {
+				change(ConversationRemoved, conv, nil)
+			}
+		}
+	}
+	if len(changes) == 0 && update.Conversation != nil {
+		// conversation attributes sent along with another notification
+		touch(update.Conversation.ConversationId.GetId())
+	}
+
+	list.handlersLock.RLock()
+	handlers := list.handlers
+	list.handlersLock.RUnlock()
+	for _, change := range changes {
+		for _, handler := range handlers {
+			(*handler)(change)
+		}
+	}
+}
+
+type conversationsBySortTimestamp []*Conversation
+
+func (c conversationsBySortTimestamp) Len() int      { return len(c) }
+func (c conversationsBySortTimestamp) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c conversationsBySortTimestamp) Less(i, j int) bool {
+	return c[i].SortTimestamp() > c[j].SortTimestamp()
+}
@@ -0,0 +1,62 @@
+package hangups
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func newTestConversationState(conversationId string, events int) *hangouts.ConversationState {
+	state := &hangouts.ConversationState{
+		ConversationId: &hangouts.ConversationId{Id: proto.String(conversationId)},
+		Conversation:   &hangouts.Conversation{ConversationId: &hangouts.ConversationId{Id: proto.String(conversationId)}},
+	}
+	for ind := 1; ind <= events; ind++ {
+		state.Event = append(state.Event, &hangouts.Event{
+			EventId:   proto.String(fmt.Sprintf("event%d", ind)),
+			Timestamp: proto.Uint64(uint64(ind)),
+		})
+	}
+	return state
+}
+
+func TestNewConversationListMaxEvents(t *testing.T) {
+	tests := []struct {
+		options *ConversationListOptions
+		events  int
+		want    int
+	}{
+		{nil, DefaultMaxConversationEvents + 5, DefaultMaxConversationEvents},
+		{&ConversationListOptions{MaxEvents: 2}, 5, 2},
+		{&ConversationListOptions{MaxEvents: -1}, DefaultMaxConversationEvents + 5, DefaultMaxConversationEvents + 5},
+	}
+	for _, test := range tests {
+		c := &Client{}
+		list := NewConversationList(c, []*hangouts.ConversationState{newTestConversationState("conv", test.events)}, test.options)
+		events := list.Get("conv").Events()
+		if len(events) != test.want {
+			t.Errorf("%+v: kept %d of %d synced events, want %d", test.options, len(events), test.events, test.want)
+			continue
+		}
+		if newest := events[len(events)-1].GetEventId(); newest != fmt.Sprintf("event%d", test.events) {
+			t.Errorf("%+v: newest event %s, want event%d", test.options, newest, test.events)
+		}
+	}
+}
+
+func TestConversationListRemoveChangeHandler(t *testing.T) {
+	c := &Client{}
+	list := NewConversationList(c, nil, nil)
+	defer list.Close()
+	kept, removed := 0, 0
+	list.AddChangeHandler(func(change *ConversationChange) { kept++ })
+	remove := list.AddChangeHandler(func(change *ConversationChange) { removed++ })
+	remove()
+
+	c.ProcessStateUpdate(&hangouts.StateUpdate{Conversation: newTestConversationState("conv", 0).Conversation})
+	if kept == 0 || removed != 0 {
+		t.Errorf("kept handler called %d times, removed one %d times", kept, removed)
+	}
+}
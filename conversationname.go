@@ -0,0 +1,175 @@
+package hangups
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Conversation Names
+*
+* Conversations only have a name when someone set one. Otherwise the
+* official clients name them after the other participants: "Alice" for a
+* one-to-one conversation, "Alice, Bob and Carol" for a group, and
+* "Alice, Bob and 3 others" once the list gets long.
+ */
+
+// Default number of participant names in a conversation name before the
+// rest are counted as "others".
+const DefaultMaxConversationNames = 3
+
+// Options of ConversationName.
+type ConversationNameOptions struct {
+	// Number of names shown before the rest are counted as "others",
+	// DefaultMaxConversationNames when zero, no limit when negative.
+	MaxNames int
+	// Use first names in group conversations, like the official clients do
+	// in the conversation list.
+	FirstNames bool
+	// Language of the joining words, such as "en" or "de-AT". English when
+	// empty or unsupported.
+	Locale string
+}
+
+// Words used to join participant names in a language.
+type conversationNameWords struct {
+	separator string // between names but the last two
+	and       string // between the last two names
+	others    string // format for the number of names left out
+	empty     string // name of a conversation without other participants
+}
+
+var conversationNameLocales = map[string]*conversationNameWords{
+	"en": {", ", " and ", "%d others", "Empty conversation"},
+	"de": {", ", " und ", "%d weitere Personen", "Leere Unterhaltung"},
+	"es": {", ", " y ", "%d personas más", "Conversación vacía"},
+	"fr": {", ", " et ", "%d autres personnes", "Conversation vide"},
+	"it": {", ", " e ", "%d altre persone", "Conversazione vuota"},
+	"nl": {", ", " en ", "%d andere personen", "Leeg gesprek"},
+	"pt": {", ", " e ", "%d outras pessoas", "Conversa vazia"},
+}
+
+// Return the name to show for a conversation: its custom name if it has
+// one, else the names of the other participants. Names come from users
+// (which may be nil) when it knows them, else from the participants'
+// fallback names. ConversationName doesn't fetch anything: call
+// users.GetUsers first for entity display names of unknown participants.
+// options may be nil for the defaults.
+func ConversationName(conversation *hangouts.Conversation, users *UserList, options *ConversationNameOptions) string {
+	if conversation.GetName() != "" {
+		return conversation.GetName()
+	}
+	if options == nil {
+		options = &ConversationNameOptions{}
+	}
+	words := conversationNameLocale(options.Locale)
+
+	selfId := conversation.GetSelfConversationState().GetSelfReadState().GetParticipantId().GetGaiaId()
+	if users != nil && users.selfId != "" {
+		selfId = users.selfId
+	}
+	name := participantName
+	if options.FirstNames {
+		name = participantFirstName
+	}
+	others := make([]*hangouts.ConversationParticipantData, 0)
+	for _, participantData := range conversationNameParticipants(conversation) {
+		if participantData.Id.GetGaiaId() != selfId {
+			others = append(others, participantData)
+		}
+	}
+	if len(others) == 1 {
+		// first names are for groups only
+		name = participantName
+	}
+	names := make([]string, len(others))
+	for ind, participantData := range others {
+		names[ind] = name(participantData.Id.GetGaiaId(), participantData.GetFallbackName(), users)
+	}
+	return joinConversationNames(names, options.MaxNames, words)
+}
+
+// Return the participants of a conversation, only the current ones when
+// they are known.
+func conversationNameParticipants(conversation *hangouts.Conversation) []*hangouts.ConversationParticipantData {
+	if len(conversation.GetCurrentParticipant()) == 0 {
+		return conversation.GetParticipantData()
+	}
+	current := make(map[string]bool)
+	for _, participantId := range conversation.GetCurrentParticipant() {
+		current[participantId.GetGaiaId()] = true
+	}
+	participants := make([]*hangouts.ConversationParticipantData, 0, len(current))
+	for _, participantData := range conversation.GetParticipantData() {
+		if current[participantData.Id.GetGaiaId()] {
+			participants = append(participants, participantData)
+		}
+	}
+	return participants
+}
+
+// Return the name of a participant: the user's name if users knows it, else
+// the fallback name, else "Unknown".
+func participantName(gaiaId, fallbackName string, users *UserList) string {
+	if users != nil {
+		if user := users.Cached(gaiaId); user != nil && (user.DisplayName != "" || user.FirstName != "") {
+			return user.Name()
+		}
+	}
+	if fallbackName != "" {
+		return fallbackName
+	}
+	return "Unknown"
+}
+
+// Return the first name of a participant, the first word of its name when
+// the first name isn't known.
+func participantFirstName(gaiaId, fallbackName string, users *UserList) string {
+	if users != nil {
+		if user := users.Cached(gaiaId); user != nil && user.FirstName != "" {
+			return user.FirstName
+		}
+	}
+	return strings.SplitN(participantName(gaiaId, fallbackName, users), " ", 2)[0]
+}
+
+// Return the words of a locale, falling back from "de-AT" to "de" and
+// to English.
+func conversationNameLocale(locale string) *conversationNameWords {
+	language := strings.ToLower(strings.SplitN(strings.Replace(locale, "_", "-", -1), "-", 2)[0])
+	if words, found := conversationNameLocales[language]; found {
+		return words
+	}
+	return conversationNameLocales["en"]
+}
+
+// Join names as "A", "A and B", "A, B and C" or "A, B and 3 others".
+func joinConversationNames(names []string, maxNames int, words *conversationNameWords) string {
+	if maxNames == 0 {
+		maxNames = DefaultMaxConversationNames
+	}
+	if len(names) == 0 {
+		return words.empty
+	}
+	// "and 1 other" takes the room of the name it stands for
+	if maxNames > 0 && len(names) > maxNames+1 {
+		others := fmt.Sprintf(words.others, len(names)-maxNames)
+		names = append(names[:maxNames:maxNames], others)
+	}
+
+	var out bytes.Buffer
+	for ind, name := range names {
+		switch {
+		case ind == 0:
+		case ind == len(names)-1:
+			out.WriteString(words.and)
+		default:
+			out.WriteString(words.separator)
+		}
+		out.WriteString(name)
+	}
+	return out.String()
+}
@@ -0,0 +1,100 @@
+package hangups
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+// Name of an easter egg animation, see Client.EasterEgg.
+type EasterEggName string
+
+// Easter eggs known to official clients.
+const (
+	EasterEggPonies     EasterEggName = "ponies"
+	EasterEggPonyStream EasterEggName = "ponystream"
+	EasterEggPitchforks EasterEggName = "pitchforks"
+	EasterEggBikeshed   EasterEggName = "bikeshed"
+	EasterEggShyDino    EasterEggName = "shydino"
+)
+
+var easterEggNames = []EasterEggName{
+	EasterEggPonies,
+	EasterEggPonyStream,
+	EasterEggPitchforks,
+	EasterEggBikeshed,
+	EasterEggShyDino,
+}
+
+// Return the known easter eggs.
+func EasterEggNames() []EasterEggName {
+	names := make([]EasterEggName, len(easterEggNames))
+	copy(names, easterEggNames)
+	return names
+}
+
+// Report whether official clients know this easter egg.
+func (n EasterEggName) Valid() bool {
+	for _, name := range easterEggNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse an easter egg name as typed in a chat ("/ponies", "Ponies").
+func ParseEasterEgg(text string) (EasterEggName, error) {
+	name := EasterEggName(strings.ToLower(strings.TrimPrefix(strings.TrimSpace(text), "/")))
+	if !name.Valid() {
+		return "", fmt.Errorf("Unknown easter egg %q", text)
+	}
+	return name, nil
+}
+
+// An easter egg received in a conversation.
+type EasterEggEvent struct {
+	Name           EasterEggName
+	ConversationId string
+	SenderId       string
+	// Fallback name of the sender in the conversation, "" if unknown.
+	SenderName string
+	// Last known state of the conversation, nil if it hasn't been seen.
+	Conversation *hangouts.Conversation
+}
+
+// Called for every easter egg received.
+type EasterEggHandler func(event *EasterEggEvent)
+
+// Register a handler to be called for every EasterEggNotification processed
+// (see ProcessStateUpdate). Call the returned function to remove it.
+func (c *Client) AddEasterEggHandler(handler EasterEggHandler) func() {
+	return c.AddStateUpdateHandler(func(update *hangouts.StateUpdate) {
+		if event := c.EasterEggEvent(update); event != nil {
+			handler(event)
+		}
+	})
+}
+
+// Decode the EasterEggNotification of a StateUpdate, resolving the
+// conversation and sender from cached state. Returns nil for other updates.
+func (c *Client) EasterEggEvent(update *hangouts.StateUpdate) *EasterEggEvent {
+	notification := update.GetEasterEggNotification()
+	if notification == nil {
+		return nil
+	}
+	event := &EasterEggEvent{
+		Name:           EasterEggName(notification.EasterEgg.GetMessage()),
+		ConversationId: notification.ConversationId.GetId(),
+		SenderId:       notification.SenderId.GetGaiaId(),
+	}
+	event.Conversation = c.CachedConversation(event.ConversationId)
+	for _, participantData := range event.Conversation.GetParticipantData() {
+		if participantData.Id.GetGaiaId() == event.SenderId {
+			event.SenderName = participantData.GetFallbackName()
+			break
+		}
+	}
+	return event
+}
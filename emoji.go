@@ -0,0 +1,223 @@
+package hangups
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+* Emoji
+*
+* Official clients turn ":smile:" shortcodes and ":)" emoticons into emoji as
+* they are typed. EmojiText does the same for text sent through this
+* package (see MessageBuilder.Transform), and EmojiShortcodes turns emoji in
+* received text back into shortcodes for platforms that prefer them.
+ */
+
+// Shortcodes and the emoji they stand for. Every emoji appears once, so this
+// also gives the shortcode EmojiShortcodes writes for it.
+var emojiTable = map[string]string{
+	"+1":                           "👍",
+	"-1":                           "👎",
+	"angry":                        "😠",
+	"astonished":                   "😲",
+	"blush":                        "😊",
+	"broken_heart":                 "💔",
+	"clap":                         "👏",
+	"confused":                     "😕",
+	"cool":                         "😎",
+	"cry":                          "😢",
+	"disappointed":                 "😞",
+	"expressionless":               "😑",
+	"eyes":                         "👀",
+	"fire":                         "🔥",
+	"flushed":                      "😳",
+	"frowning":                     "😦",
+	"grin":                         "😁",
+	"grinning":                     "😀",
+	"heart":                        "❤️",
+	"heart_eyes":                   "😍",
+	"hugs":                         "🤗",
+	"innocent":                     "😇",
+	"joy":                          "😂",
+	"kissing_heart":                "😘",
+	"laughing":                     "😆",
+	"neutral_face":                 "😐",
+	"ok_hand":                      "👌",
+	"open_mouth":                   "😮",
+	"pensive":                      "😔",
+	"poop":                         "💩",
+	"pray":                         "🙏",
+	"rage":                         "😡",
+	"raised_hands":                 "🙌",
+	"relaxed":                      "☺️",
+	"rofl":                         "🤣",
+	"scream":                       "😱",
+	"see_no_evil":                  "🙈",
+	"sleeping":                     "😴",
+	"slightly_frowning":            "🙁",
+	"slightly_smiling":             "🙂",
+	"smile":                        "😄",
+	"smiley":                       "😃",
+	"smirk":                        "😏",
+	"sob":                          "😭",
+	"sparkles":                     "✨",
+	"star":                         "⭐",
+	"stuck_out_tongue":             "😛",
+	"stuck_out_tongue_winking_eye": "😜",
+	"sunglasses":                   "🕶️",
+	"sweat_smile":                  "😅",
+	"tada":                         "🎉",
+	"thinking":                     "🤔",
+	"tired_face":                   "😫",
+	"unamused":                     "😒",
+	"upside_down":                  "🙃",
+	"v":                            "✌️",
+	"wave":                         "👋",
+	"weary":                        "😩",
+	"white_check_mark":             "✅",
+	"wink":                         "😉",
+	"worried":                      "😟",
+	"x":                            "❌",
+	"yum":                          "😋",
+	"zipper_mouth":                 "🤐",
+}
+
+// Other names for emoji in emojiTable.
+var emojiAliases = map[string]string{
+	"thumbsup":      "+1",
+	"thumbsdown":    "-1",
+	"lol":           "joy",
+	"satisfied":     "laughing",
+	"shit":          "poop",
+	"hankey":        "poop",
+	"slight_smile":  "slightly_smiling",
+	"slight_frown":  "slightly_frowning",
+	"thinking_face": "thinking",
+	"hugging":       "hugs",
+	"tongue":        "stuck_out_tongue",
+	"check":         "white_check_mark",
+	"hooray":        "tada",
+}
+
+// Emoticons and the shortcodes of the emoji they turn into.
+var emoticonTable = map[string]string{
+	":)":  "slightly_smiling",
+	":-)": "slightly_smiling",
+	"=)":  "slightly_smiling",
+	":D":  "smiley",
+	":-D": "smiley",
+	"=D":  "smiley",
+	";)":  "wink",
+	";-)": "wink",
+	":(":  "slightly_frowning",
+	":-(": "slightly_frowning",
+	":'(": "cry",
+	":P":  "stuck_out_tongue",
+	":-P": "stuck_out_tongue",
+	":p":  "stuck_out_tongue",
+	";P":  "stuck_out_tongue_winking_eye",
+	":O":  "open_mouth",
+	":-O": "open_mouth",
+	":o":  "open_mouth",
+	":|":  "neutral_face",
+	":-|": "neutral_face",
+	":/":  "confused",
+	":-/": "confused",
+	"B-)": "cool",
+	"XD":  "laughing",
+	"<3":  "heart",
+	"</3": "broken_heart",
+	"^_^": "blush",
+	"O:)": "innocent",
+	">:(": "angry",
+}
+
+var emojiShortcodeRegexp = regexp.MustCompile(`:[a-z0-9_+\-]+:`)
+
+// Replaces emoji with their shortcodes, longest emoji first.
+var emojiShortcodeReplacer *strings.Replacer
+
+func init() {
+	emojis := make(emojisByLength, 0)
+	for shortcode, emoji := range emojiTable {
+		emojis = append(emojis, emojiShortcode{emoji, ":" + shortcode + ":"})
+		// received text often lacks the emoji presentation selector
+		if bare := strings.TrimSuffix(emoji, "\ufe0f"); bare != emoji {
+			emojis = append(emojis, emojiShortcode{bare, ":" + shortcode + ":"})
+		}
+	}
+	sort.Sort(emojis)
+
+	oldnew := make([]string, 0, 2*len(emojis))
+	for _, emoji := range emojis {
+		oldnew = append(oldnew, emoji.emoji, emoji.shortcode)
+	}
+	emojiShortcodeReplacer = strings.NewReplacer(oldnew...)
+}
+
+// Return the emoji for a shortcode, with or without colons, and whether it
+// is known.
+func Emoji(shortcode string) (string, bool) {
+	shortcode = strings.Trim(shortcode, ":")
+	if alias, ok := emojiAliases[shortcode]; ok {
+		shortcode = alias
+	}
+	emoji, ok := emojiTable[shortcode]
+	return emoji, ok
+}
+
+// Replace known ":shortcode:"s and whitespace separated emoticons with
+// emoji. Unknown shortcodes are left alone.
+func EmojiText(text string) string {
+	text = emojiShortcodeRegexp.ReplaceAllStringFunc(text, func(shortcode string) string {
+		if emoji, ok := Emoji(shortcode); ok {
+			return emoji
+		}
+		return shortcode
+	})
+
+	// emoticons only count as whole words, so "http://" or "a:(b" stay
+	start := -1
+	replaced := make([]string, 0)
+	last := 0
+	for ind, r := range text + " " {
+		if !unicode.IsSpace(r) {
+			if start < 0 {
+				start = ind
+			}
+			continue
+		}
+		if start >= 0 {
+			if shortcode, ok := emoticonTable[text[start:ind]]; ok {
+				replaced = append(replaced, text[last:start], emojiTable[shortcode])
+				last = ind
+			}
+			start = -1
+		}
+	}
+	if len(replaced) == 0 {
+		return text
+	}
+	return strings.Join(replaced, "") + text[last:]
+}
+
+// Replace known emoji with their ":shortcode:"s.
+func EmojiShortcodes(text string) string {
+	return emojiShortcodeReplacer.Replace(text)
+}
+
+type emojiShortcode struct{ emoji, shortcode string }
+
+type emojisByLength []emojiShortcode
+
+func (e emojisByLength) Len() int      { return len(e) }
+func (e emojisByLength) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e emojisByLength) Less(i, j int) bool {
+	if len(e[i].emoji) != len(e[j].emoji) {
+		return len(e[i].emoji) > len(e[j].emoji)
+	}
+	return e[i].emoji < e[j].emoji
+}
@@ -0,0 +1,149 @@
+package hangups
+
+import (
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Event Handling
+*
+* The server pushes state changes as StateUpdate messages. Whatever receives
+* them (a push channel, or ProcessSyncAllNewEvents when polling) hands them to
+* ProcessStateUpdate, which updates the client's cached state and then calls
+* every registered handler in order.
+ */
+
+// Called for every StateUpdate processed by the client.
+type StateUpdateHandler func(update *hangouts.StateUpdate)
+
+// A registered StateUpdateHandler, compared by pointer on removal as
+// functions can't be compared.
+type stateUpdateHandlerEntry struct {
+	handler StateUpdateHandler
+}
+
+// Register a handler to be called for every processed StateUpdate. Call
+// the returned function to remove it again; calling it more than once is
+// harmless.
+func (c *Client) AddStateUpdateHandler(handler StateUpdateHandler) func() {
+	entry := &stateUpdateHandlerEntry{handler}
+	c.handlersLock.Lock()
+	defer c.handlersLock.Unlock()
+	c.handlers = append(c.handlers, entry)
+	return func() { c.removeStateUpdateHandler(entry) }
+}
+
+func (c *Client) removeStateUpdateHandler(entry *stateUpdateHandlerEntry) {
+	c.handlersLock.Lock()
+	defer c.handlersLock.Unlock()
+	// copied rather than modified in place, ProcessStateUpdate may be
+	// iterating over the old slice
+	handlers := make([]*stateUpdateHandlerEntry, 0, len(c.handlers))
+	for _, registered := range c.handlers {
+		if registered != entry {
+			handlers = append(handlers, registered)
+		}
+	}
+	c.handlers = handlers
+}
+
+// Update cached state from a StateUpdate and pass it on to the handlers.
+func (c *Client) ProcessStateUpdate(update *hangouts.StateUpdate) {
+	if update == nil {
+		return
+	}
+	c.cacheConversation(update.Conversation)
+	if notification := update.GetConversationNotification(); notification != nil {
+		c.cacheConversation(notification.Conversation)
+	}
+	if notification := update.GetViewModification(); notification != nil {
+		c.setCachedConversationView(notification.ConversationId.GetId(), notification.GetNewView())
+	}
+	if notification := update.GetReplyToInviteNotification(); notification != nil {
+		c.setCachedConversationInviteReply(notification.ConversationId.GetId(), notification.GetType())
+	}
+	if notification := update.GetEventNotification(); notification != nil {
+		c.processEvent(notification.Event)
+	}
+	if notification := update.GetBlockNotification(); notification != nil {
+		c.setBlockStates(notification.BlockStateChange)
+	}
+	if notification := update.GetWatermarkNotification(); notification != nil {
+		c.setCachedConversationWatermark(notification.ConversationId.GetId(), notification.SenderId.GetGaiaId(), notification.GetLatestReadTimestamp())
+	}
+	if notification := update.GetNotificationLevelNotification(); notification != nil {
+		c.setCachedConversationNotificationLevel(notification.ConversationId.GetId(), notification.GetLevel())
+	}
+	if notification := update.GetDeleteNotification(); notification != nil {
+		if notification.DeleteAction.GetDeleteType() == hangouts.DeleteType_DELETE_TYPE_UPPER_BOUND {
+			c.uncacheConversation(notification.ConversationId.GetId())
+		}
+	}
+
+	c.handlersLock.RLock()
+	handlers := c.handlers
+	c.handlersLock.RUnlock()
+	for _, entry := range handlers {
+		entry.handler(update)
+	}
+}
+
+// Process every StateUpdate in a BatchUpdate, in order.
+func (c *Client) ProcessBatchUpdate(batch *hangouts.BatchUpdate) {
+	for _, update := range batch.GetStateUpdate() {
+		c.ProcessStateUpdate(update)
+	}
+}
+
+// Turn the result of SyncAllNewEvents into StateUpdates and process them.
+// This lets clients that poll instead of using a push channel share the
+// same handlers.
+func (c *Client) ProcessSyncAllNewEvents(response *hangouts.SyncAllNewEventsResponse) {
+	for _, update := range StateUpdatesFromConversationStates(response.GetConversationState()) {
+		c.ProcessStateUpdate(update)
+	}
+}
+
+// Convert synced conversation states to the StateUpdates the server would
+// have pushed for them: a ConversationNotification per conversation
+// followed by an EventNotification per event.
+func StateUpdatesFromConversationStates(conversationStates []*hangouts.ConversationState) []*hangouts.StateUpdate {
+	updates := make([]*hangouts.StateUpdate, 0)
+	for _, conversationState := range conversationStates {
+		if conversationState.Conversation != nil {
+			updates = append(updates, &hangouts.StateUpdate{
+				StateUpdate: &hangouts.StateUpdate_ConversationNotification{
+					ConversationNotification: &hangouts.ConversationNotification{Conversation: conversationState.Conversation},
+				},
+			})
+		}
+		for _, event := range conversationState.Event {
+			updates = append(updates, &hangouts.StateUpdate{
+				StateUpdate: &hangouts.StateUpdate_EventNotification{
+					EventNotification: &hangouts.EventNotification{Event: event},
+				},
+			})
+		}
+	}
+	return updates
+}
+
+// Update cached conversation state from a conversation event.
+func (c *Client) processEvent(event *hangouts.Event) {
+	if event == nil {
+		return
+	}
+	conversationId := event.ConversationId.GetId()
+	if event.OtrModification != nil {
+		c.setCachedConversationOtrStatus(conversationId, event.OtrModification.GetNewOtrStatus())
+	}
+	if event.ConversationRename != nil {
+		c.setCachedConversationName(conversationId, event.ConversationRename.GetNewName())
+	}
+	if event.MembershipChange != nil {
+		c.setCachedConversationMembership(conversationId, event.MembershipChange)
+	}
+	if event.GetAdvancesSortTimestamp() {
+		c.advanceCachedConversationSortTimestamp(conversationId, event.GetTimestamp())
+	}
+}
@@ -0,0 +1,57 @@
+package hangups
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestRemoveStateUpdateHandler(t *testing.T) {
+	c := &Client{}
+	called := make([]string, 0)
+	register := func(name string) func() {
+		return c.AddStateUpdateHandler(func(update *hangouts.StateUpdate) {
+			called = append(called, name)
+		})
+	}
+	register("a")
+	removeB := register("b")
+	register("c")
+
+	c.ProcessStateUpdate(&hangouts.StateUpdate{})
+	removeB()
+	removeB()
+	c.ProcessStateUpdate(&hangouts.StateUpdate{})
+	if want := []string{"a", "b", "c", "a", "c"}; !reflect.DeepEqual(called, want) {
+		t.Errorf("handlers called %v, want %v", called, want)
+	}
+}
+
+func TestTrackerCloseRemovesHandler(t *testing.T) {
+	c := &Client{}
+	tracker := NewTypingTracker(c)
+	typing := func() *hangouts.StateUpdate {
+		return &hangouts.StateUpdate{StateUpdate: &hangouts.StateUpdate_TypingNotification{
+			TypingNotification: &hangouts.SetTypingNotification{
+				ConversationId: &hangouts.ConversationId{Id: proto.String("conv")},
+				SenderId:       &hangouts.ParticipantId{GaiaId: proto.String("1")},
+				Type:           hangouts.TypingType_TYPING_TYPE_STARTED.Enum(),
+			},
+		}}
+	}
+	c.ProcessStateUpdate(typing())
+	if len(tracker.Typing("conv")) != 1 {
+		t.Fatal("tracker missed the typing notification")
+	}
+	tracker.Update("conv", "1", hangouts.TypingType_TYPING_TYPE_STOPPED)
+	tracker.Close()
+	c.ProcessStateUpdate(typing())
+	if typing := tracker.Typing("conv"); len(typing) != 0 {
+		t.Errorf("closed tracker still updated: %v", typing)
+	}
+	if len(c.handlers) != 0 {
+		t.Errorf("%d handlers left after Close, want 0", len(c.handlers))
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
-	"strings"
+	"os"
 	"time"
 
 	"github.com/gpavlidi/go-hangups"
@@ -24,6 +24,17 @@ func main() {
 	// find whoami and seed the sync timestamp to current time
 	getSelfInfo, _ := c.GetSelfInfo()
 	serverNowUsecs := *getSelfInfo.ResponseHeader.CurrentServerTime
+	users := hangups.NewUserList(c)
+
+	// only a client with a push channel can be the active one, and the
+	// channel assigns its id; this example polls, so take the id of a
+	// channel opened elsewhere, if any
+	if clientId := os.Getenv("HANGOUTS_CLIENT_ID"); clientId != "" {
+		active := hangups.NewActiveClientManager(c)
+		active.SetClientId(clientId)
+		OrDie(active.Start())
+		defer active.Close()
+	}
 
 	ticker := time.NewTicker(time.Second * 5)
 	for _ = range ticker.C {
@@ -32,23 +43,13 @@ func main() {
 
 		for _, conversation := range newEvents.ConversationState {
 
-			//find or generate conversation name
-			conversationName := ""
-			if conversation.Conversation.Name != nil {
-				conversationName = fmt.Sprintf("hangouts-%s", *conversation.Conversation.Name)
-			} else {
-				participants := make([]string, 0)
-				for _, participant := range conversation.Conversation.ParticipantData {
-					// skip my name from participants list
-					if *participant.Id.GaiaId == *getSelfInfo.SelfEntity.Id.GaiaId {
-						continue
-					}
-					participants = append(participants, *participant.FallbackName)
-				}
-				conversationName = fmt.Sprintf("hangouts-%s", strings.Join(participants, ","))
-			}
+			conversationName := "hangouts-" + hangups.ConversationName(conversation.Conversation, users, nil)
 
 			for _, event := range conversation.Event {
+				// only chat, sms and voicemail messages carry text
+				if !hangups.IsMessageEvent(event) {
+					continue
+				}
 				senderId := *event.SenderId.GaiaId
 
 				// dont echo my msgs
@@ -57,25 +58,28 @@ func main() {
 				}
 
 				// find sender name
-				senderName := "Unknown"
-				for _, participant := range conversation.Conversation.ParticipantData {
-					if *participant.Id.GaiaId == senderId {
-						senderName = *participant.FallbackName
-						break
-					}
-				}
+				sender, _ := users.Get(senderId)
+				senderName := sender.Name()
 
 				// reconstruct msg text
-				for _, segment := range event.ChatMessage.MessageContent.Segment {
-					if *segment.Type != 1 {
-						//skip SegmentType_SEGMENT_TYPE_LINE_BREAK
-						fmt.Println("[", conversationName, "] ", senderName, ":", *segment.Text, " (", *segment.Type, ")")
-					}
+				text := hangups.RenderText(event.ChatMessage.GetMessageContent())
+				if hangups.IsActionEvent(event) {
+					fmt.Println("[", conversationName, "] *", senderName, text)
+				} else {
+					fmt.Println("[", conversationName, "] ", senderName, ":", text)
 				}
 			}
 
 			// mark all events in this conversation as read
 			_, _ = c.UpdateWatermark(*conversation.ConversationId.Id, serverNowUsecs)
 		}
+
+		// invitations come with the new events, SyncRecentConversations
+		// doesn't return them; join the ones from colleagues
+		for _, invite := range c.PendingInvites() {
+			if colleague, _ := invite.FromDomain(users, "example.com"); colleague {
+				_, _ = c.ReplyToInvite(invite.ConversationId, true)
+			}
+		}
 	}
 }
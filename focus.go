@@ -0,0 +1,327 @@
+package hangups
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Focus
+*
+* A client focuses a conversation while it is shown to the user, which
+* other participants see as a SetFocusNotification. FocusManager focuses the
+* conversations a bot is handling and unfocuses them once the bot has been
+* idle in them for a while, and tracks which other users have a
+* conversation focused and on which device.
+ */
+
+// Default time after the last activity in a conversation after which
+// FocusManager unfocuses it.
+const DefaultFocusIdleTimeout = 60 * time.Second
+
+// Time after which another user's focus that wasn't repeated is considered
+// lost, as clients that go away don't always unfocus.
+const FocusTimeout = 120 * time.Second
+
+// The focus of a user in a conversation.
+type FocusStatus struct {
+	ConversationId string
+	GaiaId         string
+	// FOCUS_TYPE_FOCUSED, or FOCUS_TYPE_UNFOCUSED in changes once the user
+	// left the conversation or the status expired.
+	Type   hangouts.FocusType
+	Device hangouts.FocusDevice
+	// When the status was received.
+	Updated time.Time
+}
+
+// Called when a user's focus changes.
+type FocusChangeHandler func(status *FocusStatus)
+
+// a conversation focused by FocusManager
+type focusSession struct {
+	lastSent time.Time   // when FOCUSED was last sent, zero if not yet
+	idle     *time.Timer // unfocuses the conversation
+	touches  int         // tells the current idle timer from stopped ones
+}
+
+// Manages the self user's focus and tracks other users' focus, safe for
+// concurrent use.
+//
+//	focus := hangups.NewFocusManager(client)
+//	defer focus.Stop()
+//	...
+//	// on every message the bot handles
+//	focus.Touch(conversationId)
+type FocusManager struct {
+	client        *Client
+	removeHandler func() // removes the StateUpdate handler, see Close
+
+	// Time after the last Touch after which a conversation is unfocused,
+	// DefaultFocusIdleTimeout when zero.
+	IdleTimeout time.Duration
+	// Age after which another user's focus expires, FocusTimeout when zero.
+	Timeout time.Duration
+
+	sessions     map[string]*focusSession
+	sessionsLock sync.Mutex
+
+	// focus statuses by conversation id, then gaia id
+	statuses     map[string]map[string]*FocusStatus
+	statusesLock sync.Mutex
+
+	handlers     []*FocusChangeHandler // by pointer, so they can be removed
+	handlersLock sync.RWMutex
+
+	// schedules idle timeouts and expiries, time.AfterFunc but in tests
+	afterFunc func(d time.Duration, f func()) *time.Timer
+}
+
+// Create a focus manager fed by the SetFocusNotifications the client
+// processes.
+func NewFocusManager(c *Client) *FocusManager {
+	manager := &FocusManager{
+		client:    c,
+		sessions:  make(map[string]*focusSession),
+		statuses:  make(map[string]map[string]*FocusStatus),
+		afterFunc: time.AfterFunc,
+	}
+	manager.removeHandler = c.AddStateUpdateHandler(func(update *hangouts.StateUpdate) {
+		if notification := update.GetFocusNotification(); notification != nil {
+			manager.Update(notification)
+		}
+	})
+	return manager
+}
+
+// Register a handler to be called when a user focuses or unfocuses a
+// conversation, or switches devices, including expiries. Call the returned
+// function to remove it.
+func (m *FocusManager) AddChangeHandler(handler FocusChangeHandler) func() {
+	entry := &handler
+	m.handlersLock.Lock()
+	defer m.handlersLock.Unlock()
+	m.handlers = append(m.handlers, entry)
+	return func() {
+		m.handlersLock.Lock()
+		defer m.handlersLock.Unlock()
+		handlers := make([]*FocusChangeHandler, 0, len(m.handlers))
+		for _, registered := range m.handlers {
+			if registered != entry {
+				handlers = append(handlers, registered)
+			}
+		}
+		m.handlers = handlers
+	}
+}
+
+// Stop, then stop following the SetFocusNotifications the client
+// processes.
+func (m *FocusManager) Close() error {
+	err := m.Stop()
+	m.removeHandler()
+	return err
+}
+
+// Record activity in a conversation: it is focused if it isn't, and
+// unfocused once there was no activity for IdleTimeout.
+func (m *FocusManager) Touch(conversationId string) error {
+	idleTimeout := m.idleTimeout()
+
+	m.sessionsLock.Lock()
+	session := m.sessions[conversationId]
+	if session == nil {
+		session = &focusSession{}
+		m.sessions[conversationId] = session
+	}
+	if session.idle != nil {
+		session.idle.Stop()
+	}
+	session.touches++
+	touches := session.touches
+	session.idle = m.afterFunc(idleTimeout, func() { m.expire(conversationId, session, touches) })
+	// the focus is sent with the idle timeout, repeat it before it lapses
+	send := time.Since(session.lastSent) >= idleTimeout/2
+	m.sessionsLock.Unlock()
+	if !send {
+		return nil
+	}
+
+	now := time.Now()
+	_, err := m.client.SetFocus(conversationId, false, uint32(idleTimeout/time.Second))
+	if err != nil {
+		return err
+	}
+	m.sessionsLock.Lock()
+	session.lastSent = now
+	m.sessionsLock.Unlock()
+	return nil
+}
+
+// Unfocus a conversation focused by Touch now.
+func (m *FocusManager) Unfocus(conversationId string) error {
+	m.sessionsLock.Lock()
+	session := m.sessions[conversationId]
+	delete(m.sessions, conversationId)
+	m.sessionsLock.Unlock()
+	if session == nil {
+		return nil
+	}
+	session.idle.Stop()
+	_, err := m.client.SetFocus(conversationId, true, 0)
+	return err
+}
+
+// Report whether a conversation is focused by Touch.
+func (m *FocusManager) IsFocused(conversationId string) bool {
+	m.sessionsLock.Lock()
+	defer m.sessionsLock.Unlock()
+	_, found := m.sessions[conversationId]
+	return found
+}
+
+// Unfocus all conversations focused by Touch. Returns the first error.
+func (m *FocusManager) Stop() error {
+	m.sessionsLock.Lock()
+	conversationIds := make([]string, 0, len(m.sessions))
+	for conversationId := range m.sessions {
+		conversationIds = append(conversationIds, conversationId)
+	}
+	m.sessionsLock.Unlock()
+
+	var firstErr error
+	for _, conversationId := range conversationIds {
+		if err := m.Unfocus(conversationId); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Return the other users that have a conversation focused, sorted by gaia
+// id. The self user's other clients are left out too.
+func (m *FocusManager) Focused(conversationId string) []*FocusStatus {
+	selfId := ""
+	if self := m.client.SelfEntity(); self != nil {
+		selfId = self.Id.GetGaiaId()
+	}
+	m.statusesLock.Lock()
+	defer m.statusesLock.Unlock()
+	focused := make([]*FocusStatus, 0)
+	for gaiaId, status := range m.statuses[conversationId] {
+		if gaiaId != selfId {
+			focused = append(focused, status)
+		}
+	}
+	sort.Sort(focusByGaiaId(focused))
+	return focused
+}
+
+// Record a user's focus from a SetFocusNotification. Handlers are called if
+// it changed.
+func (m *FocusManager) Update(notification *hangouts.SetFocusNotification) {
+	conversationId := notification.ConversationId.GetId()
+	gaiaId := notification.SenderId.GetGaiaId()
+	if conversationId == "" || gaiaId == "" {
+		return
+	}
+	status := &FocusStatus{
+		ConversationId: conversationId,
+		GaiaId:         gaiaId,
+		Type:           notification.GetType(),
+		Device:         notification.GetDevice(),
+		Updated:        time.Now(),
+	}
+	focused := status.Type == hangouts.FocusType_FOCUS_TYPE_FOCUSED
+
+	m.statusesLock.Lock()
+	previous := m.statuses[conversationId][gaiaId]
+	if focused {
+		if m.statuses[conversationId] == nil {
+			m.statuses[conversationId] = make(map[string]*FocusStatus)
+		}
+		m.statuses[conversationId][gaiaId] = status
+		timeout := m.Timeout
+		if timeout <= 0 {
+			timeout = FocusTimeout
+		}
+		m.afterFunc(timeout, func() { m.expireStatus(status) })
+	} else {
+		delete(m.statuses[conversationId], gaiaId)
+		if len(m.statuses[conversationId]) == 0 {
+			delete(m.statuses, conversationId)
+		}
+	}
+	m.statusesLock.Unlock()
+
+	changed := previous == nil && focused ||
+		previous != nil && (!focused || previous.Device != status.Device)
+	if !changed {
+		return
+	}
+	if !focused {
+		status.Type = hangouts.FocusType_FOCUS_TYPE_UNFOCUSED
+	}
+	m.notify(status)
+}
+
+// Drop another user's focus that hasn't been replaced since it was set.
+func (m *FocusManager) expireStatus(status *FocusStatus) {
+	m.statusesLock.Lock()
+	if m.statuses[status.ConversationId][status.GaiaId] != status {
+		m.statusesLock.Unlock()
+		return
+	}
+	delete(m.statuses[status.ConversationId], status.GaiaId)
+	if len(m.statuses[status.ConversationId]) == 0 {
+		delete(m.statuses, status.ConversationId)
+	}
+	m.statusesLock.Unlock()
+
+	m.notify(&FocusStatus{
+		ConversationId: status.ConversationId,
+		GaiaId:         status.GaiaId,
+		Type:           hangouts.FocusType_FOCUS_TYPE_UNFOCUSED,
+		Device:         status.Device,
+		Updated:        time.Now(),
+	})
+}
+
+func (m *FocusManager) notify(status *FocusStatus) {
+	m.handlersLock.RLock()
+	handlers := m.handlers
+	m.handlersLock.RUnlock()
+	for _, handler := range handlers {
+		(*handler)(status)
+	}
+}
+
+func (m *FocusManager) idleTimeout() time.Duration {
+	if m.IdleTimeout <= 0 {
+		return DefaultFocusIdleTimeout
+	}
+	return m.IdleTimeout
+}
+
+// Unfocus a conversation that wasn't touched again since its idle timer was
+// set.
+func (m *FocusManager) expire(conversationId string, session *focusSession, touches int) {
+	m.sessionsLock.Lock()
+	if m.sessions[conversationId] != session || session.touches != touches {
+		m.sessionsLock.Unlock()
+		return
+	}
+	delete(m.sessions, conversationId)
+	m.sessionsLock.Unlock()
+	// the focus lapses on its own if this fails
+	m.client.SetFocus(conversationId, true, 0)
+}
+
+type focusByGaiaId []*FocusStatus
+
+func (s focusByGaiaId) Len() int           { return len(s) }
+func (s focusByGaiaId) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s focusByGaiaId) Less(i, j int) bool { return s[i].GaiaId < s[j].GaiaId }
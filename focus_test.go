@@ -0,0 +1,82 @@
+package hangups
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+// Collects the functions a FocusManager schedules so tests can run them in
+// place of the timers.
+type fakeFocusTimers struct {
+	timeouts []time.Duration
+	funcs    []func()
+}
+
+func (timers *fakeFocusTimers) afterFunc(d time.Duration, f func()) *time.Timer {
+	timers.timeouts = append(timers.timeouts, d)
+	timers.funcs = append(timers.funcs, f)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return timer
+}
+
+func TestFocusManagerExpiresOtherUsersFocus(t *testing.T) {
+	manager := NewFocusManager(&Client{})
+	defer manager.Close()
+	timers := &fakeFocusTimers{}
+	manager.afterFunc = timers.afterFunc
+	manager.Timeout = 50 * time.Millisecond
+	changes := make([]*FocusStatus, 0)
+	manager.AddChangeHandler(func(status *FocusStatus) { changes = append(changes, status) })
+
+	focus := &hangouts.SetFocusNotification{
+		ConversationId: &hangouts.ConversationId{Id: proto.String("conv")},
+		SenderId:       &hangouts.ParticipantId{GaiaId: proto.String("1")},
+		Type:           hangouts.FocusType_FOCUS_TYPE_FOCUSED.Enum(),
+		Device:         hangouts.FocusDevice_FOCUS_DEVICE_DESKTOP.Enum(),
+	}
+	manager.Update(focus)
+	manager.Update(focus)
+	if len(changes) != 1 || changes[0].Type != hangouts.FocusType_FOCUS_TYPE_FOCUSED {
+		t.Fatalf("changes after focusing twice: %v, want a single FOCUSED", changes)
+	}
+	if len(timers.funcs) != 2 || timers.timeouts[0] != manager.Timeout {
+		t.Fatalf("scheduled %v, want two expiries after %v", timers.timeouts, manager.Timeout)
+	}
+
+	// the first expiry is for the focus the repeat replaced
+	timers.funcs[0]()
+	if len(manager.Focused("conv")) != 1 || len(changes) != 1 {
+		t.Fatal("repeated focus expired with the first one")
+	}
+
+	timers.funcs[1]()
+	if len(changes) != 2 || changes[1].Type != hangouts.FocusType_FOCUS_TYPE_UNFOCUSED || changes[1].GaiaId != "1" {
+		t.Fatalf("changes after the expiry: %v, want UNFOCUSED for \"1\"", changes)
+	}
+	if focused := manager.Focused("conv"); len(focused) != 0 {
+		t.Errorf("%d users still focused after the expiry", len(focused))
+	}
+}
+
+func TestFocusManagerRemoveChangeHandler(t *testing.T) {
+	manager := NewFocusManager(&Client{})
+	defer manager.Close()
+	manager.afterFunc = (&fakeFocusTimers{}).afterFunc
+	kept, removed := 0, 0
+	manager.AddChangeHandler(func(status *FocusStatus) { kept++ })
+	remove := manager.AddChangeHandler(func(status *FocusStatus) { removed++ })
+	remove()
+
+	manager.Update(&hangouts.SetFocusNotification{
+		ConversationId: &hangouts.ConversationId{Id: proto.String("conv")},
+		SenderId:       &hangouts.ParticipantId{GaiaId: proto.String("1")},
+		Type:           hangouts.FocusType_FOCUS_TYPE_FOCUSED.Enum(),
+	})
+	if kept != 1 || removed != 0 {
+		t.Errorf("kept handler called %d times, removed one %d times, want 1 and 0", kept, removed)
+	}
+}
@@ -0,0 +1,70 @@
+package hangups
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Answers protobuf api requests in place of clients6.google.com. ApiRequest
+// uses the default transport, which fakeApi replaces until restore.
+type fakeApi struct {
+	t       *testing.T
+	respond func(endpoint string, payload []byte) (proto.Message, error)
+
+	requests []string // endpoints requested, in order
+	lock     sync.Mutex
+
+	transport http.RoundTripper
+}
+
+func newFakeApi(t *testing.T, respond func(endpoint string, payload []byte) (proto.Message, error)) *fakeApi {
+	api := &fakeApi{t: t, respond: respond, transport: http.DefaultTransport}
+	http.DefaultTransport = api
+	return api
+}
+
+func (api *fakeApi) restore() {
+	http.DefaultTransport = api.transport
+}
+
+// Return the endpoints requested so far.
+func (api *fakeApi) Requests() []string {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	return append([]string(nil), api.requests...)
+}
+
+func (api *fakeApi) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "clients6.google.com" {
+		api.t.Errorf("unexpected request to %s", req.URL)
+		return nil, http.ErrNotSupported
+	}
+	endpoint := strings.TrimPrefix(req.URL.Path, "/chat/v1/")
+	payload, _ := ioutil.ReadAll(req.Body)
+	api.lock.Lock()
+	api.requests = append(api.requests, endpoint)
+	api.lock.Unlock()
+
+	response, err := api.respond(endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := proto.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	body := base64.StdEncoding.EncodeToString(encoded)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/x-protobuf"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Request:    req,
+	}, nil
+}
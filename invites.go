@@ -0,0 +1,101 @@
+package hangups
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+// A conversation the self user has been invited to but hasn't joined yet.
+type Invite struct {
+	ConversationId string
+	// gaia id of the user that sent the invitation, see InviterEmails
+	InviterId string
+	// when the invitation was sent
+	Timestamp uint64
+	// high affinity invitations come from people the user talks to
+	Affinity     hangouts.InvitationAffinity
+	Conversation *hangouts.Conversation
+}
+
+// List the invitations found in synced conversations that haven't been
+// answered yet, oldest first.
+// Only conversations returned by earlier sync/get calls are considered.
+// SyncRecentConversations only syncs the inbox, which invitations aren't
+// part of: they arrive with SyncAllNewEvents and the ConversationNotifications
+// given to ProcessStateUpdate, so poll or process those before calling this.
+func (c *Client) PendingInvites() []*Invite {
+	invites := make([]*Invite, 0)
+	for _, conversation := range c.CachedConversations() {
+		selfState := conversation.SelfConversationState
+		if selfState.GetStatus() != hangouts.ConversationStatus_CONVERSATION_STATUS_INVITED {
+			continue
+		}
+		invites = append(invites, &Invite{
+			ConversationId: conversation.ConversationId.GetId(),
+			InviterId:      selfState.InviterId.GetGaiaId(),
+			Timestamp:      selfState.GetInviteTimestamp(),
+			Affinity:       selfState.GetInviteAffinity(),
+			Conversation:   conversation,
+		})
+	}
+	sort.Sort(invitesByTimestamp(invites))
+	return invites
+}
+
+// Return the emails of the user that sent the invitation. Invitations only
+// carry the inviter's gaia id, so the inviter's entity is looked up through
+// users, which fetches it if it isn't cached (see UserList.Get).
+func (invite *Invite) InviterEmails(users *UserList) ([]string, error) {
+	if invite.InviterId == "" {
+		return nil, nil
+	}
+	inviter, err := users.Get(invite.InviterId)
+	if err != nil {
+		return nil, err
+	}
+	return inviter.Emails, nil
+}
+
+// Report whether the user that sent the invitation has an email in one of
+// domains ("example.com"), for accepting invitations from allow-listed
+// domains. See InviterEmails.
+func (invite *Invite) FromDomain(users *UserList, domains ...string) (bool, error) {
+	emails, err := invite.InviterEmails(users)
+	if err != nil {
+		return false, err
+	}
+	for _, email := range emails {
+		at := strings.LastIndex(email, "@")
+		if at < 0 {
+			continue
+		}
+		for _, domain := range domains {
+			if strings.EqualFold(email[at+1:], domain) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+type invitesByTimestamp []*Invite
+
+func (s invitesByTimestamp) Len() int           { return len(s) }
+func (s invitesByTimestamp) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s invitesByTimestamp) Less(i, j int) bool { return s[i].Timestamp < s[j].Timestamp }
+
+// Mark a cached invitation as answered so it's no longer pending.
+func (c *Client) setCachedConversationInviteReply(conversationId string, replyType hangouts.ReplyToInviteType) {
+	status := hangouts.ConversationStatus_CONVERSATION_STATUS_ACTIVE
+	if replyType == hangouts.ReplyToInviteType_REPLY_TO_INVITE_TYPE_DECLINE {
+		status = hangouts.ConversationStatus_CONVERSATION_STATUS_LEFT
+	}
+	c.updateCachedConversation(conversationId, func(conversation *hangouts.Conversation) {
+		if conversation.SelfConversationState == nil {
+			conversation.SelfConversationState = &hangouts.UserConversationState{}
+		}
+		conversation.SelfConversationState.Status = &status
+	})
+}
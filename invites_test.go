@@ -0,0 +1,73 @@
+package hangups
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestInviteFromDomain(t *testing.T) {
+	api := newFakeApi(t, func(endpoint string, payload []byte) (proto.Message, error) {
+		return &hangouts.GetEntityByIdResponse{Entity: []*hangouts.Entity{{
+			Id:         &hangouts.ParticipantId{GaiaId: proto.String("1")},
+			Properties: &hangouts.EntityProperties{Email: []string{"alice@gmail.com", "Alice@Example.com"}},
+		}}}, nil
+	})
+	defer api.restore()
+
+	users := NewUserList(&Client{Session: &Session{}})
+	defer users.Close()
+	invite := &Invite{ConversationId: "conv", InviterId: "1"}
+	tests := []struct {
+		domains []string
+		want    bool
+	}{
+		{[]string{"example.com"}, true},
+		{[]string{"other.com", "EXAMPLE.COM"}, true},
+		{[]string{"mail.example.com", "xample.com"}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		got, err := invite.FromDomain(users, test.domains...)
+		if err != nil {
+			t.Fatalf("FromDomain(%v) failed: %v", test.domains, err)
+		}
+		if got != test.want {
+			t.Errorf("FromDomain(%v) = %v, want %v", test.domains, got, test.want)
+		}
+	}
+	if requests := api.Requests(); len(requests) != 1 || requests[0] != "contacts/getentitybyid" {
+		t.Errorf("requests %v, want a single getentitybyid", requests)
+	}
+}
+
+func TestPendingInvitesFromSyncAllNewEvents(t *testing.T) {
+	invited := hangouts.ConversationStatus_CONVERSATION_STATUS_INVITED
+	api := newFakeApi(t, func(endpoint string, payload []byte) (proto.Message, error) {
+		return &hangouts.SyncAllNewEventsResponse{ConversationState: []*hangouts.ConversationState{{
+			ConversationId: &hangouts.ConversationId{Id: proto.String("conv")},
+			Conversation: &hangouts.Conversation{
+				ConversationId: &hangouts.ConversationId{Id: proto.String("conv")},
+				SelfConversationState: &hangouts.UserConversationState{
+					Status:          &invited,
+					InviterId:       &hangouts.ParticipantId{GaiaId: proto.String("1")},
+					InviteTimestamp: proto.Uint64(42),
+				},
+			},
+		}}}, nil
+	})
+	defer api.restore()
+
+	c := &Client{Session: &Session{}}
+	if invites := c.PendingInvites(); len(invites) != 0 {
+		t.Fatalf("%d invites before syncing, want none", len(invites))
+	}
+	if _, err := c.SyncAllNewEvents(0, 1048576); err != nil {
+		t.Fatalf("SyncAllNewEvents failed: %v", err)
+	}
+	invites := c.PendingInvites()
+	if len(invites) != 1 || invites[0].ConversationId != "conv" || invites[0].InviterId != "1" || invites[0].Timestamp != 42 {
+		t.Errorf("PendingInvites = %+v, want the invitation to conv from 1", invites)
+	}
+}
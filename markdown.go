@@ -0,0 +1,494 @@
+package hangups
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Markdown
+*
+* Converts between a practical subset of Markdown and message segments:
+* **bold** (or __bold__), *italic* (or _italic_), ~~strikethrough~~,
+* [text](url), bare urls, line breaks and backslash escapes. `code` spans
+* are kept as literal text since Hangouts has no monospace formatting.
+* Hangouts underline has no Markdown equivalent and is dropped on the way out.
+ */
+
+// a link at the start of the text, see linkRegexp
+var linkPrefixRegexp = regexp.MustCompile(`^(?i)(?:https?://|mailto:)[^\s<>"]+`)
+
+// url schemes in plain text, escaped so they aren't turned into links
+var linkSchemeRegexp = regexp.MustCompile(`(?i)\b(https?|mailto):`)
+
+// Convert Markdown to segments.
+func MarkdownSegments(markdown string) []*hangouts.Segment {
+	return NewMessageBuilder().Markdown(markdown).Build()
+}
+
+// Append text written in Markdown. See MarkdownSegments.
+func (b *MessageBuilder) Markdown(markdown string) *MessageBuilder {
+	parser := &markdownParser{builder: b}
+	parser.parse(strings.Replace(markdown, "\r\n", "\n", -1), NoFormat, "")
+	return b
+}
+
+type markdownParser struct {
+	builder *MessageBuilder
+}
+
+// parse appends the segments for text using format. Inside a link,
+// linkTarget is set and all text becomes part of the link.
+func (p *markdownParser) parse(text string, format Format, linkTarget string) {
+	var literal bytes.Buffer
+	flush := func() {
+		p.emit(literal.String(), format, linkTarget)
+		literal.Reset()
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isASCIIPunct(text[i+1]):
+			literal.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end >= 0 {
+				literal.WriteString(text[i : i+end+2])
+				i += end + 2
+				continue
+			}
+		case c == '[':
+			if label, target, length, ok := parseMarkdownLink(text[i:]); ok {
+				flush()
+				if linkTarget != "" {
+					// links can't nest, keep the outer one
+					target = linkTarget
+				}
+				if label == "" {
+					label = target
+				}
+				p.parse(label, format, target)
+				i += length
+				continue
+			}
+		case isMarkdownLinkStart(text, i):
+			// take urls as is so their _ and * aren't taken as formatting
+			link := trimLinkPunctuation(linkPrefixRegexp.FindString(text[i:]))
+			if linkPrefixRegexp.MatchString(link) {
+				if linkTarget == "" {
+					flush()
+					p.builder.FormattedLink(link, link, format)
+				} else {
+					literal.WriteString(link)
+				}
+				i += len(link)
+				continue
+			}
+		default:
+			if delimiter, flag := markdownOpener(text, i); delimiter != "" {
+				if strings.HasPrefix(text[i:], "***") && isBoldAroundItalic(text, i) {
+					delimiter, flag = "**", Bold
+				}
+				if end := markdownCloser(text, i+len(delimiter), delimiter); end >= 0 {
+					flush()
+					p.parse(text[i+len(delimiter):end], format|flag, linkTarget)
+					i = end + len(delimiter)
+					continue
+				}
+				literal.WriteString(delimiter)
+				i += len(delimiter)
+				continue
+			}
+		}
+		literal.WriteByte(c)
+		i++
+	}
+	flush()
+}
+
+func (p *markdownParser) emit(text string, format Format, linkTarget string) {
+	if text == "" {
+		return
+	}
+	// links were found while parsing, so no FormattedText here
+	for ind, line := range strings.Split(text, "\n") {
+		if ind > 0 {
+			p.builder.LineBreak()
+		}
+		if linkTarget == "" {
+			p.builder.appendText(line, format)
+		} else if line != "" {
+			p.builder.FormattedLink(line, linkTarget, format)
+		}
+	}
+}
+
+// Parse "[label](target)" at the start of text. length is the number of bytes
+// consumed.
+func parseMarkdownLink(text string) (label, target string, length int, ok bool) {
+	closeBracket := matchingBracket(text, '[', ']')
+	if closeBracket < 0 || !strings.HasPrefix(text[closeBracket+1:], "(") {
+		return "", "", 0, false
+	}
+	start := closeBracket + 2
+	destination := strings.TrimLeftFunc(text[start:], unicode.IsSpace)
+	start += len(text[start:]) - len(destination)
+
+	var closeParen int
+	if strings.HasPrefix(destination, "<") {
+		// <url with spaces or unbalanced (parens>
+		end := 1
+		for end < len(destination) && destination[end] != '>' {
+			if destination[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(destination) {
+			return "", "", 0, false
+		}
+		closeParen = strings.IndexByte(destination[end:], ')')
+		if closeParen < 0 {
+			return "", "", 0, false
+		}
+		target = destination[1:end]
+		closeParen += start + end
+	} else {
+		closeParen = matchingBracket(text[closeBracket+1:], '(', ')')
+		if closeParen < 0 {
+			return "", "", 0, false
+		}
+		closeParen += closeBracket + 1
+		// drop an optional title: [label](url "title")
+		if fields := strings.Fields(text[start:closeParen]); len(fields) > 0 {
+			target = fields[0]
+		}
+	}
+	if target == "" {
+		return "", "", 0, false
+	}
+	return text[1:closeBracket], unescapeMarkdown(target), closeParen + 1, true
+}
+
+// Index of the bracket closing the one at text[0], skipping escapes and
+// nested pairs. -1 if there is none.
+func matchingBracket(text string, open, close byte) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Report whether a bare url starts at text[i].
+func isMarkdownLinkStart(text string, i int) bool {
+	switch text[i] {
+	case 'h', 'H', 'm', 'M':
+	default:
+		return false
+	}
+	if i > 0 && isWordByte(text[i-1]) {
+		return false
+	}
+	return linkPrefixRegexp.MatchString(text[i:])
+}
+
+// Return the formatting delimiter opening at text[i], if any.
+// Openers must be followed by a non space; underscores also can't open in the
+// middle of a word (snake_case).
+func markdownOpener(text string, i int) (string, Format) {
+	var delimiter string
+	var format Format
+	switch {
+	case strings.HasPrefix(text[i:], "***"):
+		// italic around bold, see isBoldAroundItalic
+		delimiter, format = "*", Italic
+	case strings.HasPrefix(text[i:], "**"):
+		delimiter, format = "**", Bold
+	case strings.HasPrefix(text[i:], "__"):
+		delimiter, format = "__", Bold
+	case strings.HasPrefix(text[i:], "~~"):
+		delimiter, format = "~~", Strikethrough
+	case text[i] == '*':
+		delimiter, format = "*", Italic
+	case text[i] == '_':
+		delimiter, format = "_", Italic
+	default:
+		return "", NoFormat
+	}
+	next := i + len(delimiter)
+	if next >= len(text) || isSpaceAt(text, next) {
+		return "", NoFormat
+	}
+	if delimiter[0] == '_' && i > 0 && isWordByte(text[i-1]) {
+		return "", NoFormat
+	}
+	return delimiter, format
+}
+
+// Report whether "***" at text[i] opens bold around italic (***a* b**)
+// rather than italic around bold (***a** b*).
+func isBoldAroundItalic(text string, i int) bool {
+	end := markdownCloser(text, i+2, "**")
+	return end >= 0 && markdownCloser(text[i+2:end], 1, "*") >= 0
+}
+
+// Return the index of the delimiter closing a span that starts at text[start],
+// or -1. Closers must follow a non space; underscores also can't close in
+// the middle of a word.
+func markdownCloser(text string, start int, delimiter string) int {
+	boldOpen, italicOpen := false, false
+	for j := start; j < len(text); j++ {
+		switch {
+		case text[j] == '\\':
+			j++
+			continue
+		case text[j] == '`':
+			if end := strings.IndexByte(text[j+1:], '`'); end >= 0 {
+				j += end + 1
+			}
+			continue
+		case text[j] == '[':
+			if _, _, length, ok := parseMarkdownLink(text[j:]); ok {
+				j += length - 1
+				continue
+			}
+		case isMarkdownLinkStart(text, j):
+			j += len(trimLinkPunctuation(linkPrefixRegexp.FindString(text[j:]))) - 1
+			continue
+		}
+
+		canClose := j > start && !isSpaceBefore(text, j)
+		if delimiter == "*" && strings.HasPrefix(text[j:], "**") {
+			// "***" closes italic right away unless a bold span is open
+			if strings.HasPrefix(text[j:], "***") && !boldOpen && canClose {
+				return j
+			}
+			boldOpen = !boldOpen
+			j++
+			continue
+		}
+		if delimiter == "**" && text[j] == '*' {
+			if strings.HasPrefix(text[j:], "***") && italicOpen && canClose {
+				// "***" closes an inner italic span first
+				return j + 1
+			}
+			if !strings.HasPrefix(text[j:], "**") {
+				italicOpen = !italicOpen
+				continue
+			}
+		}
+		if !strings.HasPrefix(text[j:], delimiter) || !canClose {
+			continue
+		}
+		if delimiter[0] == '_' && j+len(delimiter) < len(text) && isWordByte(text[j+len(delimiter)]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func isSpaceAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsSpace(r)
+}
+
+func isSpaceBefore(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return unicode.IsSpace(r)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= utf8.RuneSelf
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+// Convert segments to Markdown that MarkdownSegments turns back into the
+// same segments. Underline is dropped, and whitespace at the edge of a
+// formatted span loses that formatting as Markdown can't express it.
+func SegmentsMarkdown(segments []*hangouts.Segment) string {
+	writer := &markdownWriter{}
+	for ind, segment := range segments {
+		format := FormatOf(segment.Formatting) &^ Underline
+		switch segment.GetType() {
+		case hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK:
+			writer.out.WriteString("\n")
+		case hangouts.SegmentType_SEGMENT_TYPE_LINK:
+			text := segment.GetText()
+			target := segment.LinkData.GetLinkTarget()
+			if target == "" {
+				writer.write(EscapeMarkdown(text), format)
+			} else if text == target && format == NoFormat && len(writer.open) == 0 && isBareLink(text) && writer.atWordBoundary() && bareLinkEnds(segments, ind+1) {
+				writer.out.WriteString(text)
+			} else {
+				writer.write("["+EscapeMarkdown(text)+"]("+escapeMarkdownTarget(target)+")", format)
+			}
+		default:
+			writer.write(EscapeMarkdown(segment.GetText()), format)
+		}
+	}
+	writer.setFormat(NoFormat)
+	return writer.out.String()
+}
+
+// Writes Markdown, opening and closing formatting delimiters as needed.
+// Spans are kept open across segments so nested formatting nests.
+type markdownWriter struct {
+	out bytes.Buffer
+	// open formatting spans, outermost first
+	open []Format
+}
+
+func (w *markdownWriter) write(text string, format Format) {
+	if text == "" {
+		return
+	}
+	core := strings.TrimLeftFunc(text, unicode.IsSpace)
+	if core == "" {
+		// a formatted space can't start a span, write it as is
+		w.out.WriteString(text)
+		return
+	}
+	w.closeSpans(format)
+	if w.openFormat() != format {
+		// openers can't be followed by a space
+		w.out.WriteString(text[:len(text)-len(core)])
+		text = core
+	}
+	w.openSpans(format)
+	w.out.WriteString(text)
+}
+
+// Report whether a bare url written next would be recognized as one.
+func (w *markdownWriter) atWordBoundary() bool {
+	out := w.out.Bytes()
+	return len(out) == 0 || !isWordByte(out[len(out)-1])
+}
+
+func (w *markdownWriter) openFormat() Format {
+	format := NoFormat
+	for _, flag := range w.open {
+		format |= flag
+	}
+	return format
+}
+
+// Close the spans not in format and open the missing ones.
+func (w *markdownWriter) setFormat(format Format) {
+	w.closeSpans(format)
+	w.openSpans(format)
+}
+
+// Close the spans not in format, along with the spans nested in them.
+func (w *markdownWriter) closeSpans(format Format) {
+	keep := 0
+	for keep < len(w.open) && format&w.open[keep] != 0 {
+		keep++
+	}
+	for len(w.open) > keep {
+		w.close()
+	}
+}
+
+// Open the spans in format that aren't open yet.
+func (w *markdownWriter) openSpans(format Format) {
+	for _, flag := range []Format{Strikethrough, Bold, Italic} {
+		if format&flag != 0 && w.openFormat()&flag == 0 {
+			w.out.WriteString(markdownDelimiter(flag))
+			w.open = append(w.open, flag)
+		}
+	}
+}
+
+func (w *markdownWriter) close() {
+	flag := w.open[len(w.open)-1]
+	w.open = w.open[:len(w.open)-1]
+
+	// closers can't follow a space, move trailing spaces after the closer
+	text := w.out.String()
+	core := strings.TrimRightFunc(text, unicode.IsSpace)
+	w.out.Truncate(len(core))
+	w.out.WriteString(markdownDelimiter(flag))
+	w.out.WriteString(text[len(core):])
+}
+
+func markdownDelimiter(flag Format) string {
+	switch flag {
+	case Strikethrough:
+		return "~~"
+	case Bold:
+		return "**"
+	}
+	return "*"
+}
+
+// Escape text so Markdown shows it literally.
+func EscapeMarkdown(text string) string {
+	var out bytes.Buffer
+	for i := 0; i < len(text); i++ {
+		if strings.IndexByte("\\`*_~[]", text[i]) >= 0 {
+			out.WriteByte('\\')
+		}
+		out.WriteByte(text[i])
+	}
+	return linkSchemeRegexp.ReplaceAllString(out.String(), `$1\:`)
+}
+
+// Remove backslash escapes.
+func unescapeMarkdown(text string) string {
+	if strings.IndexByte(text, '\\') < 0 {
+		return text
+	}
+	var out bytes.Buffer
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) && isASCIIPunct(text[i+1]) {
+			i++
+		}
+		out.WriteByte(text[i])
+	}
+	return out.String()
+}
+
+// Escape a link target so it parses back unchanged. Targets with spaces or
+// unbalanced parens are written as <target>.
+func escapeMarkdownTarget(target string) string {
+	target = strings.Replace(target, "\\", "\\\\", -1)
+	if strings.IndexFunc(target, unicode.IsSpace) >= 0 || matchingBracket("("+target+")", '(', ')') != len(target)+1 {
+		return "<" + strings.NewReplacer("<", "\\<", ">", "\\>").Replace(target) + ">"
+	}
+	return target
+}
+
+func isBareLink(text string) bool {
+	return linkPrefixRegexp.FindString(text) == text && trimLinkPunctuation(text) == text
+}
+
+// A bare link only parses back to itself if nothing sticks to its end.
+func bareLinkEnds(segments []*hangouts.Segment, next int) bool {
+	if next >= len(segments) || segments[next].GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK {
+		return true
+	}
+	text := segments[next].GetText()
+	return text == "" || isSpaceAt(text, 0)
+}
@@ -0,0 +1,161 @@
+package hangups
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+// Describe segments compactly: quoted text, ":" and format flags, "->" and
+// the link target; line breaks as <br>.
+func describeSegments(segments []*hangouts.Segment) string {
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK {
+			parts = append(parts, "<br>")
+			continue
+		}
+		part := fmt.Sprintf("%q", segment.GetText())
+		if flags := formatFlags(FormatOf(segment.Formatting)); flags != "" {
+			part += ":" + flags
+		}
+		if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINK {
+			part += "->" + segment.GetLinkData().GetLinkTarget()
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatFlags(format Format) string {
+	flags := ""
+	if format&Bold != 0 {
+		flags += "b"
+	}
+	if format&Italic != 0 {
+		flags += "i"
+	}
+	if format&Strikethrough != 0 {
+		flags += "s"
+	}
+	if format&Underline != 0 {
+		flags += "u"
+	}
+	return flags
+}
+
+// Describe segments rune by rune, so that segments split differently but
+// showing the same text compare equal. Formatting of whitespace isn't
+// visible and is left out.
+func describeRunes(segments []*hangouts.Segment) string {
+	parts := make([]string, 0)
+	for _, segment := range segments {
+		if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK {
+			parts = append(parts, "<br>")
+			continue
+		}
+		for _, r := range segment.GetText() {
+			part := string(r)
+			if !unicode.IsSpace(r) {
+				part += ":" + formatFlags(FormatOf(segment.Formatting))
+			}
+			if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINK {
+				part += "->" + segment.GetLinkData().GetLinkTarget()
+			}
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestMarkdownSegments(t *testing.T) {
+	tests := []struct {
+		markdown string
+		want     string
+	}{
+		// formatting and nesting
+		{"**bold**", `"bold":b`},
+		{"__bold__ and _italic_", `"bold":b " and " "italic":i`},
+		{"~~gone~~", `"gone":s`},
+		{"***both***", `"both":bi`},
+		{"***a** b*", `"a":bi " b":i`},
+		{"**a *b* c**", `"a ":b "b":bi " c":b`},
+		{"*unclosed", `"*unclosed"`},
+		{"2 * 3 * 4", `"2 * 3 * 4"`},
+		// escapes and code
+		{`\*not italic\*`, `"*not italic*"`},
+		{`a\_b`, `"a_b"`},
+		{`a\b`, `"a\\b"`},
+		{"`*code*`", "\"`*code*`\""},
+		// intraword underscores
+		{"snake_case_name", `"snake_case_name"`},
+		{"_a_b", `"_a_b"`},
+		// bare urls and trailing punctuation
+		{"see https://example.com/a.", `"see " "https://example.com/a"->https://example.com/a "."`},
+		{"(https://example.com/x)", `"(" "https://example.com/x"->https://example.com/x ")"`},
+		{"https://example.com/a_b?x=1, ok", `"https://example.com/a_b?x=1"->https://example.com/a_b?x=1 ", ok"`},
+		// links
+		{"[docs](https://example.com)", `"docs"->https://example.com`},
+		{"[docs](<https://example.com/a b>)", `"docs"->https://example.com/a b`},
+		{"[**bold** link](https://example.com)", `"bold":b->https://example.com " link"->https://example.com`},
+		// line breaks
+		{"line1\nline2", `"line1" <br> "line2"`},
+		{"line1\r\nline2", `"line1" <br> "line2"`},
+	}
+	for _, test := range tests {
+		if got := describeSegments(MarkdownSegments(test.markdown)); got != test.want {
+			t.Errorf("MarkdownSegments(%q)\n got: %s\nwant: %s", test.markdown, got, test.want)
+		}
+	}
+}
+
+func TestSegmentsMarkdown(t *testing.T) {
+	tests := []struct {
+		segments []*hangouts.Segment
+		want     string
+	}{
+		{NewMessageBuilder().Text("plain").Build(), "plain"},
+		{NewMessageBuilder().FormattedText("bold", Bold).Build(), "**bold**"},
+		{NewMessageBuilder().FormattedText("a ", Bold).FormattedText("b", Bold|Italic).FormattedText(" c", Bold).Build(), "**a *b* c**"},
+		{NewMessageBuilder().FormattedText("under", Underline).Build(), "under"},
+		{NewMessageBuilder().Text("snake_case *star*").Build(), `snake\_case \*star\*`},
+		{NewMessageBuilder().Text("a").LineBreak().Text("b").Build(), "a\nb"},
+		{NewMessageBuilder().Link("docs", "https://example.com/a b").Build(), "[docs](<https://example.com/a b>)"},
+	}
+	for _, test := range tests {
+		if got := SegmentsMarkdown(test.segments); got != test.want {
+			t.Errorf("SegmentsMarkdown(%s) = %q, want %q", describeSegments(test.segments), got, test.want)
+		}
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	tests := []string{
+		"plain text",
+		"**bold** *italic* ~~strike~~",
+		"***a** b*",
+		"**a *b* c**",
+		`\*not italic\* and a\_b`,
+		"snake_case_name and __init__",
+		"2 * 3 * 4",
+		"see https://example.com/a_b?x=1.",
+		"[docs](<https://example.com/a b>) and [**bold** link](https://example.com)",
+		"line1\nline2\n\nline4",
+		"`*code*`",
+	}
+	for _, markdown := range tests {
+		segments := MarkdownSegments(markdown)
+		written := SegmentsMarkdown(segments)
+		reparsed := MarkdownSegments(written)
+		if got, want := describeRunes(reparsed), describeRunes(segments); got != want {
+			t.Errorf("round trip of %q through %q\n got: %s\nwant: %s",
+				markdown, written, describeSegments(reparsed), describeSegments(segments))
+		}
+		if again := SegmentsMarkdown(reparsed); again != written {
+			t.Errorf("SegmentsMarkdown isn't stable for %q: %q, then %q", markdown, written, again)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package hangups
+
+import (
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Delivery Mediums
+*
+* Besides regular Hangouts (babel) messages, conversations can deliver
+* through Google Voice or local SMS. The mediums a conversation supports are
+* advertised in UserConversationState.delivery_medium_option.
+ */
+
+// Return the delivery mediums available in a conversation.
+// Empty if the conversation hasn't been synced yet.
+func (c *Client) DeliveryMediumOptions(conversationId string) []*hangouts.DeliveryMediumOption {
+	conversation := c.CachedConversation(conversationId)
+	return conversation.GetSelfConversationState().GetDeliveryMediumOption()
+}
+
+// Choose the delivery medium used for events sent to a conversation.
+// Pass nil to go back to the conversation's default.
+func (c *Client) SetDeliveryMedium(conversationId string, deliveryMedium *hangouts.DeliveryMedium) {
+	c.deliveryMediumsLock.Lock()
+	defer c.deliveryMediumsLock.Unlock()
+	if deliveryMedium == nil {
+		delete(c.deliveryMediums, conversationId)
+		return
+	}
+	if c.deliveryMediums == nil {
+		c.deliveryMediums = make(map[string]*hangouts.DeliveryMedium)
+	}
+	c.deliveryMediums[conversationId] = deliveryMedium
+}
+
+// Return the delivery medium used for events sent to a conversation: the one
+// chosen with SetDeliveryMedium, else the conversation's current default,
+// else plain Hangouts.
+func (c *Client) DeliveryMedium(conversationId string) *hangouts.DeliveryMedium {
+	c.deliveryMediumsLock.RLock()
+	chosen := c.deliveryMediums[conversationId]
+	c.deliveryMediumsLock.RUnlock()
+	if chosen != nil {
+		return chosen
+	}
+
+	for _, option := range c.DeliveryMediumOptions(conversationId) {
+		if option.GetCurrentDefault() && option.DeliveryMedium != nil {
+			return option.DeliveryMedium
+		}
+	}
+
+	mediumType := hangouts.DeliveryMediumType_DELIVERY_MEDIUM_BABEL
+	return &hangouts.DeliveryMedium{MediumType: &mediumType}
+}
+
+// Return the first delivery medium of the given type available in a
+// conversation, or nil if there is none.
+func (c *Client) FindDeliveryMedium(conversationId string, mediumType hangouts.DeliveryMediumType) *hangouts.DeliveryMedium {
+	for _, option := range c.DeliveryMediumOptions(conversationId) {
+		if option.DeliveryMedium.GetMediumType() == mediumType {
+			return option.DeliveryMedium
+		}
+	}
+	return nil
+}
+
+// Report whether an event carries a message: regular chat messages as well
+// as SMS, MMS and voicemail messages delivered through Google Voice.
+func IsMessageEvent(event *hangouts.Event) bool {
+	if event.GetChatMessage() == nil {
+		return false
+	}
+	switch event.GetEventType() {
+	case hangouts.EventType_EVENT_TYPE_REGULAR_CHAT_MESSAGE,
+		hangouts.EventType_EVENT_TYPE_SMS,
+		hangouts.EventType_EVENT_TYPE_MMS,
+		hangouts.EventType_EVENT_TYPE_VOICEMAIL:
+		return true
+	case hangouts.EventType_EVENT_TYPE_UNKNOWN:
+		// older events don't set a type
+		return true
+	}
+	return false
+}
+
+// Report whether an event arrived through Google Voice or SMS rather than
+// Hangouts.
+func IsPhoneEvent(event *hangouts.Event) bool {
+	switch event.GetEventType() {
+	case hangouts.EventType_EVENT_TYPE_SMS,
+		hangouts.EventType_EVENT_TYPE_MMS,
+		hangouts.EventType_EVENT_TYPE_VOICEMAIL:
+		return true
+	}
+	switch event.GetMediumType().GetMediumType() {
+	case hangouts.DeliveryMediumType_DELIVERY_MEDIUM_GOOGLE_VOICE,
+		hangouts.DeliveryMediumType_DELIVERY_MEDIUM_LOCAL_SMS:
+		return true
+	}
+	return false
+}
+
+// Return the phone number (E.164) an event was delivered through, or an
+// empty string for regular Hangouts events.
+func EventPhoneNumber(event *hangouts.Event) string {
+	return event.GetMediumType().GetPhone().GetPhoneNumber().GetE164()
+}
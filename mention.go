@@ -0,0 +1,339 @@
+package hangups
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Mentions
+*
+* Hangouts has no mention markup: people recognize their name in the text.
+* MentionResolver turns "@alice" handles typed on other platforms into the
+* names of conversation participants and back, and IsMentioned tells whether
+* an incoming message names the current user.
+ */
+
+// "@" followed by a handle, at the start of the text or after a non word
+// character so email addresses don't count
+var mentionRegexp = regexp.MustCompile(`(?:^|[^\pL\pN_.])(@[\pL\pN_.\-]+)`)
+
+// An "@handle" found in text.
+type Mention struct {
+	// The handle as written, including the "@".
+	Text string
+	// Byte offsets of Text in the text.
+	Start, End int
+	// Gaia ids of the participants the handle matches. One when the mention
+	// is resolved, more when it is ambiguous, none when it is unknown.
+	GaiaIds []string
+}
+
+// Report whether the mention matches exactly one participant.
+func (m *Mention) Resolved() bool {
+	return len(m.GaiaIds) == 1
+}
+
+// Report whether the mention matches several participants.
+func (m *Mention) Ambiguous() bool {
+	return len(m.GaiaIds) > 1
+}
+
+type mentionParticipant struct {
+	gaiaId    string
+	name      string // full name, as shown by Hangouts
+	firstName string
+}
+
+// Resolves mentions against the participants of a conversation.
+type MentionResolver struct {
+	participants []*mentionParticipant
+}
+
+// Create a resolver for the participants of conversation. Entities (from
+// GetEntityById for example) add display and first names to the fallback
+// names the conversation carries.
+func NewMentionResolver(conversation *hangouts.Conversation, entities []*hangouts.Entity) *MentionResolver {
+	properties := make(map[string]*hangouts.EntityProperties)
+	for _, entity := range entities {
+		properties[entity.Id.GetGaiaId()] = entity.Properties
+	}
+	resolver := &MentionResolver{participants: make([]*mentionParticipant, 0)}
+	for _, participantData := range conversation.GetParticipantData() {
+		gaiaId := participantData.Id.GetGaiaId()
+		participant := &mentionParticipant{gaiaId: gaiaId, name: participantData.GetFallbackName()}
+		if entityProperties := properties[gaiaId]; entityProperties != nil {
+			if entityProperties.GetDisplayName() != "" {
+				participant.name = entityProperties.GetDisplayName()
+			}
+			participant.firstName = entityProperties.GetFirstName()
+		}
+		if participant.firstName == "" {
+			participant.firstName = strings.SplitN(participant.name, " ", 2)[0]
+		}
+		if participant.name != "" {
+			resolver.participants = append(resolver.participants, participant)
+		}
+	}
+	return resolver
+}
+
+// Create a resolver for a cached conversation. See NewMentionResolver.
+func (c *Client) MentionResolver(conversationId string, entities []*hangouts.Entity) *MentionResolver {
+	return NewMentionResolver(c.CachedConversation(conversationId), entities)
+}
+
+// Return the gaia ids of the participants a handle ("@alice" or "alice")
+// refers to. A handle matching a full name ("@alicesmith", "@alice.smith")
+// wins over one matching a first name or any other word of a name.
+func (r *MentionResolver) Resolve(handle string) []string {
+	handle = normalizeMentionName(strings.TrimPrefix(handle, "@"))
+	if handle == "" {
+		return nil
+	}
+	matches := make([]string, 0)
+	for _, participant := range r.participants {
+		if normalizeMentionName(participant.name) == handle {
+			matches = append(matches, participant.gaiaId)
+		}
+	}
+	if len(matches) > 0 {
+		return matches
+	}
+	for _, participant := range r.participants {
+		if normalizeMentionName(participant.firstName) == handle {
+			matches = append(matches, participant.gaiaId)
+			continue
+		}
+		for _, word := range strings.Fields(participant.name) {
+			if normalizeMentionName(word) == handle {
+				matches = append(matches, participant.gaiaId)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// Find the "@handle"s in text and resolve them.
+func (r *MentionResolver) FindMentions(text string) []*Mention {
+	mentions := make([]*Mention, 0)
+	for _, match := range mentionRegexp.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		// "@alice." ends a sentence
+		for end > start+1 && strings.ContainsRune(".-", rune(text[end-1])) {
+			end--
+		}
+		mentions = append(mentions, &Mention{
+			Text:    text[start:end],
+			Start:   start,
+			End:     end,
+			GaiaIds: r.Resolve(text[start:end]),
+		})
+	}
+	return mentions
+}
+
+// Replace resolved "@handle"s in outgoing text with the participant's name.
+// Ambiguous and unknown handles are left as written; they are returned with
+// the others so the caller can ask which participant was meant.
+func (r *MentionResolver) ExpandMentions(text string) (string, []*Mention) {
+	mentions := r.FindMentions(text)
+	var out bytes.Buffer
+	last := 0
+	for _, mention := range mentions {
+		if !mention.Resolved() {
+			continue
+		}
+		out.WriteString(text[last:mention.Start])
+		out.WriteString(r.name(mention.GaiaIds[0]))
+		last = mention.End
+	}
+	out.WriteString(text[last:])
+	return out.String(), mentions
+}
+
+// Replace participant names in incoming text with handles, for platforms
+// that use them. handle returns the handle for a participant, without the
+// "@", or "" to leave the name alone. Longer names are replaced first.
+func (r *MentionResolver) ReplaceNames(text string, handle func(gaiaId, name string) string) string {
+	participants := make(mentionParticipantsByName, len(r.participants))
+	copy(participants, r.participants)
+	sort.Sort(participants)
+	for _, participant := range participants {
+		replacement := handle(participant.gaiaId, participant.name)
+		if replacement == "" {
+			continue
+		}
+		text = replaceWord(text, participant.name, "@"+replacement)
+	}
+	return text
+}
+
+func (r *MentionResolver) name(gaiaId string) string {
+	for _, participant := range r.participants {
+		if participant.gaiaId == gaiaId {
+			return participant.name
+		}
+	}
+	return ""
+}
+
+// Report whether a chat message event names the current user (see
+// SelfEntity), by full name, first name or "@handle". Links, whose targets
+// often contain names, and the user's own messages never count. Needs
+// GetSelfInfo to have been called.
+func (c *Client) IsMentioned(event *hangouts.Event) bool {
+	self := c.SelfEntity()
+	if self == nil || event.GetChatMessage() == nil {
+		return false
+	}
+	selfId := self.Id.GetGaiaId()
+	if event.SenderId.GetGaiaId() == selfId {
+		return false
+	}
+
+	names := []string{self.Properties.GetDisplayName(), self.Properties.GetFirstName()}
+	for _, participantData := range c.CachedConversation(event.ConversationId.GetId()).GetParticipantData() {
+		if participantData.Id.GetGaiaId() == selfId {
+			names = append(names, participantData.GetFallbackName())
+		}
+	}
+
+	text := mentionText(event.ChatMessage.MessageContent)
+	for _, name := range names {
+		if name != "" && containsWord(text, name) {
+			return true
+		}
+	}
+	resolver := &MentionResolver{participants: []*mentionParticipant{{
+		gaiaId:    selfId,
+		name:      self.Properties.GetDisplayName(),
+		firstName: self.Properties.GetFirstName(),
+	}}}
+	for _, mention := range resolver.FindMentions(text) {
+		if mention.Resolved() {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the text of message content without its links, which stand as a
+// space so the words around them stay apart.
+func mentionText(content *hangouts.MessageContent) string {
+	var out bytes.Buffer
+	for _, segment := range content.GetSegment() {
+		switch segment.GetType() {
+		case hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK:
+			out.WriteString("\n")
+		case hangouts.SegmentType_SEGMENT_TYPE_LINK:
+			out.WriteString(" ")
+		default:
+			out.WriteString(segment.GetText())
+		}
+	}
+	return out.String()
+}
+
+// Lower case a name and drop everything but letters and digits, so that
+// "Alice Smith", "alice.smith" and "alicesmith" compare equal.
+func normalizeMentionName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// Report whether text contains word (case insensitively) on word boundaries.
+func containsWord(text, word string) bool {
+	return len(wordIndexes(text, word)) > 0
+}
+
+// Replace word (case insensitively) on word boundaries.
+func replaceWord(text, word, replacement string) string {
+	var out bytes.Buffer
+	last := 0
+	for _, match := range wordIndexes(text, word) {
+		out.WriteString(text[last:match[0]])
+		out.WriteString(replacement)
+		last = match[1]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// Return the byte offsets of word in text, where it isn't part of a longer
+// word or a handle.
+func wordIndexes(text, word string) [][]int {
+	indexes := make([][]int, 0)
+	if word == "" {
+		return indexes
+	}
+	for start := 0; start < len(text); {
+		end := hasPrefixFold(text[start:], word)
+		if end >= 0 {
+			end += start
+			before, _ := utf8.DecodeLastRuneInString(text[:start])
+			after, _ := utf8.DecodeRuneInString(text[end:])
+			if !isWordRune(before) && before != '@' && !isWordRune(after) {
+				indexes = append(indexes, []int{start, end})
+				start = end
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		start += size
+	}
+	return indexes
+}
+
+// Return the length in bytes of the prefix of text that matches prefix
+// case insensitively, -1 if text doesn't start with it.
+func hasPrefixFold(text, prefix string) int {
+	n := 0
+	for _, want := range prefix {
+		if n >= len(text) {
+			return -1
+		}
+		got, size := utf8.DecodeRuneInString(text[n:])
+		if !equalFoldRune(got, want) {
+			return -1
+		}
+		n += size
+	}
+	return n
+}
+
+// Report whether two runes are equal under simple Unicode case folding.
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+type mentionParticipantsByName []*mentionParticipant
+
+func (p mentionParticipantsByName) Len() int      { return len(p) }
+func (p mentionParticipantsByName) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p mentionParticipantsByName) Less(i, j int) bool {
+	return len(p[i].name) > len(p[j].name)
+}
@@ -0,0 +1,68 @@
+package hangups
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestIsMentioned(t *testing.T) {
+	c := &Client{}
+	c.setSelfEntity(&hangouts.Entity{
+		Id:         &hangouts.ParticipantId{GaiaId: proto.String("self")},
+		Properties: &hangouts.EntityProperties{DisplayName: proto.String("Alice Smith"), FirstName: proto.String("Alice")},
+	})
+	text := func(text string) *hangouts.Segment {
+		return &hangouts.Segment{Type: hangouts.SegmentType_SEGMENT_TYPE_TEXT.Enum(), Text: proto.String(text)}
+	}
+	link := func(text, target string) *hangouts.Segment {
+		return &hangouts.Segment{
+			Type:     hangouts.SegmentType_SEGMENT_TYPE_LINK.Enum(),
+			Text:     proto.String(text),
+			LinkData: &hangouts.LinkData{LinkTarget: proto.String(target)},
+		}
+	}
+	tests := []struct {
+		name     string
+		segments []*hangouts.Segment
+		want     bool
+	}{
+		{"first name", []*hangouts.Segment{text("thanks alice!")}, true},
+		{"handle", []*hangouts.Segment{text("cc @alicesmith")}, true},
+		{"longer word", []*hangouts.Segment{text("Alicexpress")}, false},
+		{"link target", []*hangouts.Segment{link("profile", "https://example.com/alice")}, false},
+		{"mailto link", []*hangouts.Segment{text("write to "), link("alice@example.com", "mailto:alice@example.com")}, false},
+		{"text around a link", []*hangouts.Segment{text("see "), link("this", "https://example.com/x"), text(" Alice")}, true},
+	}
+	for _, test := range tests {
+		event := &hangouts.Event{
+			ConversationId: &hangouts.ConversationId{Id: proto.String("conv")},
+			SenderId:       &hangouts.ParticipantId{GaiaId: proto.String("other")},
+			ChatMessage:    &hangouts.ChatMessage{MessageContent: &hangouts.MessageContent{Segment: test.segments}},
+		}
+		if got := c.IsMentioned(event); got != test.want {
+			t.Errorf("%s: IsMentioned = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWordIndexes(t *testing.T) {
+	tests := []struct {
+		text, word string
+		want       [][]int
+	}{
+		{"Alice and ALICE", "alice", [][]int{{0, 5}, {10, 15}}},
+		{"alicebob @alice malice alice_", "alice", [][]int{}},
+		{"hi Élodie!", "élodie", [][]int{{3, 10}}},
+		{"Alice Smith, alice smith", "Alice Smith", [][]int{{0, 11}, {13, 24}}},
+		{"aalice alice", "alice", [][]int{{7, 12}}},
+		{"text", "", [][]int{}},
+	}
+	for _, test := range tests {
+		if got := wordIndexes(test.text, test.word); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wordIndexes(%q, %q) = %v, want %v", test.text, test.word, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package hangups
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+// Text formatting flags, combine them with |.
+type Format int
+
+const (
+	Bold Format = 1 << iota
+	Italic
+	Strikethrough
+	Underline
+)
+
+// Plain text without formatting.
+const NoFormat Format = 0
+
+// Convert the flags to the Formatting proto, nil if no flag is set.
+func (f Format) Formatting() *hangouts.Formatting {
+	if f == NoFormat {
+		return nil
+	}
+	formatting := &hangouts.Formatting{}
+	if f&Bold != 0 {
+		formatting.Bold = proto.Bool(true)
+	}
+	if f&Italic != 0 {
+		formatting.Italic = proto.Bool(true)
+	}
+	if f&Strikethrough != 0 {
+		formatting.Strikethrough = proto.Bool(true)
+	}
+	if f&Underline != 0 {
+		formatting.Underline = proto.Bool(true)
+	}
+	return formatting
+}
+
+// Convert a Formatting proto to flags.
+func FormatOf(formatting *hangouts.Formatting) Format {
+	format := NoFormat
+	if formatting.GetBold() {
+		format |= Bold
+	}
+	if formatting.GetItalic() {
+		format |= Italic
+	}
+	if formatting.GetStrikethrough() {
+		format |= Strikethrough
+	}
+	if formatting.GetUnderline() {
+		format |= Underline
+	}
+	return format
+}
+
+// http(s) and mailto links, up to the next whitespace
+var linkRegexp = regexp.MustCompile(`(?i)\b(?:https?://|mailto:)[^\s<>"]+`)
+
+// Builds the segments of a chat message.
+//
+//	content := hangups.NewMessageBuilder().
+//		FormattedText("Build failed", hangups.Bold).
+//		LineBreak().
+//		Text("see https://ci.example.com/42").
+//		MessageContent()
+type MessageBuilder struct {
+	segments   []*hangouts.Segment
+	transforms []TextTransform
+}
+
+// Rewrites text before a MessageBuilder adds it, EmojiText for example.
+type TextTransform func(text string) string
+
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{segments: make([]*hangouts.Segment, 0)}
+}
+
+// Append unformatted text. See FormattedText.
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	return b.FormattedText(text, NoFormat)
+}
+
+// Append text with formatting. Newlines become line break segments and
+// http(s)/mailto urls become link segments.
+func (b *MessageBuilder) FormattedText(text string, format Format) *MessageBuilder {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	for ind, line := range strings.Split(text, "\n") {
+		if ind > 0 {
+			b.LineBreak()
+		}
+		start := 0
+		for _, match := range linkRegexp.FindAllStringIndex(line, -1) {
+			link := trimLinkPunctuation(line[match[0]:match[1]])
+			if !linkRegexp.MatchString(link) {
+				// nothing left but the scheme
+				continue
+			}
+			b.appendText(line[start:match[0]], format)
+			b.FormattedLink(link, link, format)
+			start = match[0] + len(link)
+		}
+		b.appendText(line[start:], format)
+	}
+	return b
+}
+
+// Apply transform to the text appended from now on. Link text and targets
+// are left alone.
+//
+//	hangups.NewMessageBuilder().Transform(hangups.EmojiText).Text("done :tada:")
+func (b *MessageBuilder) Transform(transform TextTransform) *MessageBuilder {
+	b.transforms = append(b.transforms, transform)
+	return b
+}
+
+// Append unformatted text linking to target.
+func (b *MessageBuilder) Link(text, target string) *MessageBuilder {
+	return b.FormattedLink(text, target, NoFormat)
+}
+
+// Append formatted text linking to target.
+func (b *MessageBuilder) FormattedLink(text, target string, format Format) *MessageBuilder {
+	if text == "" {
+		text = target
+	}
+	segmentType := hangouts.SegmentType_SEGMENT_TYPE_LINK
+	b.segments = append(b.segments, &hangouts.Segment{
+		Type:       &segmentType,
+		Text:       &text,
+		Formatting: format.Formatting(),
+		LinkData:   &hangouts.LinkData{LinkTarget: &target},
+	})
+	return b
+}
+
+// Append a line break.
+func (b *MessageBuilder) LineBreak() *MessageBuilder {
+	segmentType := hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK
+	text := "\n"
+	b.segments = append(b.segments, &hangouts.Segment{Type: &segmentType, Text: &text})
+	return b
+}
+
+// Append already built segments.
+func (b *MessageBuilder) Segments(segments ...*hangouts.Segment) *MessageBuilder {
+	b.segments = append(b.segments, segments...)
+	return b
+}
+
+// Return the segments built so far.
+func (b *MessageBuilder) Build() []*hangouts.Segment {
+	return b.segments
+}
+
+// Return the segments built so far as message content.
+func (b *MessageBuilder) MessageContent() *hangouts.MessageContent {
+	return &hangouts.MessageContent{Segment: b.segments}
+}
+
+// Append a text segment, merging it into the previous one when that is
+// text with the same formatting.
+func (b *MessageBuilder) appendText(text string, format Format) {
+	for _, transform := range b.transforms {
+		text = transform(text)
+	}
+	if text == "" {
+		return
+	}
+	if last := len(b.segments) - 1; last >= 0 {
+		previous := b.segments[last]
+		if previous.GetType() == hangouts.SegmentType_SEGMENT_TYPE_TEXT && FormatOf(previous.Formatting) == format {
+			merged := previous.GetText() + text
+			previous.Text = &merged
+			return
+		}
+	}
+	segmentType := hangouts.SegmentType_SEGMENT_TYPE_TEXT
+	b.segments = append(b.segments, &hangouts.Segment{
+		Type:       &segmentType,
+		Text:       &text,
+		Formatting: format.Formatting(),
+	})
+}
+
+// Drop sentence punctuation that follows a link ("see http://x.com.") and
+// closing parens that don't belong to it ("(http://x.com)").
+func trimLinkPunctuation(link string) string {
+	for len(link) > 0 {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'", last) >= 0:
+			link = link[:len(link)-1]
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+			link = link[:len(link)-1]
+		case last == ']' && strings.Count(link, "[") < strings.Count(link, "]"):
+			link = link[:len(link)-1]
+		default:
+			return link
+		}
+	}
+	return link
+}
+
+// Convert plain text to segments. Shorthand for NewMessageBuilder().Text(text).Build().
+func TextSegments(text string) []*hangouts.Segment {
+	return NewMessageBuilder().Text(text).Build()
+}
@@ -0,0 +1,366 @@
+package hangups
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Presence
+*
+* A user is reachable while one of their clients is connected and available
+* while they aren't idle. PresenceNotifications only carry the fields that
+* changed, so PresenceTracker merges them into the last known presence, and
+* refreshes the users it watches with QueryPresence in the background.
+ */
+
+// Default interval at which PresenceTracker queries the presence of the
+// users it watches.
+const DefaultPresenceRefreshInterval = 5 * time.Minute
+
+// A kind of device a user may be active on.
+type PresenceDevice int
+
+const (
+	DeviceMobile PresenceDevice = iota
+	DeviceDesktop
+	DeviceTablet
+)
+
+// The presence of a user.
+type UserPresence struct {
+	GaiaId    string
+	Reachable bool
+	Available bool
+	Mobile    bool
+	Desktop   bool
+	Tablet    bool
+	// The user's mood message, nil if none is set.
+	Mood *hangouts.MoodContent
+	// When the presence was last received.
+	Updated time.Time
+}
+
+// Report whether the user is reachable, i.e. has a client connected.
+func (p *UserPresence) Online() bool {
+	return p.Reachable
+}
+
+// Report whether the user is reachable and active on a kind of device.
+func (p *UserPresence) OnlineOn(device PresenceDevice) bool {
+	if !p.Reachable {
+		return false
+	}
+	switch device {
+	case DeviceMobile:
+		return p.Mobile
+	case DeviceDesktop:
+		return p.Desktop
+	case DeviceTablet:
+		return p.Tablet
+	}
+	return false
+}
+
+// Return the mood message as plain text.
+func (p *UserPresence) MoodText() string {
+	return RenderText(&hangouts.MessageContent{Segment: p.Mood.GetSegment()})
+}
+
+// Return a copy of the presence with the fields set in a Presence message
+// applied. Fields that aren't set keep their value.
+func (p *UserPresence) merge(presence *hangouts.Presence) *UserPresence {
+	merged := *p
+	if presence.Reachable != nil {
+		merged.Reachable = presence.GetReachable()
+	}
+	if presence.Available != nil {
+		merged.Available = presence.GetAvailable()
+	}
+	if deviceStatus := presence.DeviceStatus; deviceStatus != nil {
+		if deviceStatus.Mobile != nil {
+			merged.Mobile = deviceStatus.GetMobile()
+		}
+		if deviceStatus.Desktop != nil {
+			merged.Desktop = deviceStatus.GetDesktop()
+		}
+		if deviceStatus.Tablet != nil {
+			merged.Tablet = deviceStatus.GetTablet()
+		}
+	}
+	if presence.MoodSetting != nil {
+		merged.Mood = presence.MoodSetting.GetMoodMessage().GetMoodContent()
+		if len(merged.Mood.GetSegment()) == 0 {
+			merged.Mood = nil
+		}
+	}
+	merged.Updated = time.Now()
+	return &merged
+}
+
+// Report whether two presences differ in anything but Updated.
+func (p *UserPresence) differs(other *UserPresence) bool {
+	return p.Reachable != other.Reachable || p.Available != other.Available ||
+		p.Mobile != other.Mobile || p.Desktop != other.Desktop || p.Tablet != other.Tablet ||
+		!proto.Equal(p.Mood, other.Mood)
+}
+
+// A change of a user's presence.
+type PresenceChange struct {
+	// The presence before the change, with only GaiaId set if it wasn't
+	// known.
+	Previous *UserPresence
+	Current  *UserPresence
+}
+
+// Report whether the user became reachable.
+func (c *PresenceChange) CameOnline() bool {
+	return !c.Previous.Online() && c.Current.Online()
+}
+
+// Report whether the user stopped being reachable.
+func (c *PresenceChange) WentOffline() bool {
+	return c.Previous.Online() && !c.Current.Online()
+}
+
+// Report whether the user became reachable on a kind of device, whether or
+// not they were online on another one.
+func (c *PresenceChange) CameOnlineOn(device PresenceDevice) bool {
+	return !c.Previous.OnlineOn(device) && c.Current.OnlineOn(device)
+}
+
+// Report whether the mood message changed.
+func (c *PresenceChange) MoodChanged() bool {
+	return !proto.Equal(c.Previous.Mood, c.Current.Mood)
+}
+
+// Called when a user's presence changes.
+type PresenceChangeHandler func(change *PresenceChange)
+
+// Tracks the presence of users, safe for concurrent use. Presences come from
+// the PresenceNotifications the client processes and from querying the
+// watched users. Handlers see every change:
+//
+//	presence := hangups.NewPresenceTracker(client)
+//	presence.AddChangeHandler(func(change *hangups.PresenceChange) {
+//		if change.CameOnlineOn(hangups.DeviceMobile) {
+//			fmt.Println(change.Current.GaiaId, "is on their phone")
+//		}
+//	})
+//	presence.Watch(gaiaIds...)
+//	presence.Start()
+//	defer presence.Stop()
+type PresenceTracker struct {
+	client        *Client
+	removeHandler func() // removes the StateUpdate handler, see Close
+
+	// Interval at which watched users are queried,
+	// DefaultPresenceRefreshInterval when zero. Takes effect on Start.
+	RefreshInterval time.Duration
+
+	presences map[string]*UserPresence
+	watched   map[string]bool
+	lock      sync.Mutex
+
+	refresh     chan struct{} // closed to stop the refresh loop
+	refreshLock sync.Mutex
+
+	handlers     []*PresenceChangeHandler // by pointer, so they can be removed
+	handlersLock sync.RWMutex
+}
+
+// Create a tracker fed by the PresenceNotifications the client processes.
+func NewPresenceTracker(c *Client) *PresenceTracker {
+	tracker := &PresenceTracker{
+		client:    c,
+		presences: make(map[string]*UserPresence),
+		watched:   make(map[string]bool),
+	}
+	tracker.removeHandler = c.AddStateUpdateHandler(func(update *hangouts.StateUpdate) {
+		if notification := update.GetPresenceNotification(); notification != nil {
+			tracker.Update(notification.Presence)
+		}
+	})
+	return tracker
+}
+
+// Register a handler to be called for every presence change.
+// Call the returned function to remove it.
+func (t *PresenceTracker) AddChangeHandler(handler PresenceChangeHandler) func() {
+	entry := &handler
+	t.handlersLock.Lock()
+	defer t.handlersLock.Unlock()
+	t.handlers = append(t.handlers, entry)
+	return func() {
+		t.handlersLock.Lock()
+		defer t.handlersLock.Unlock()
+		handlers := make([]*PresenceChangeHandler, 0, len(t.handlers))
+		for _, registered := range t.handlers {
+			if registered != entry {
+				handlers = append(handlers, registered)
+			}
+		}
+		t.handlers = handlers
+	}
+}
+
+// Stop refreshing and stop following the PresenceNotifications the client
+// processes.
+func (t *PresenceTracker) Close() {
+	t.Stop()
+	t.removeHandler()
+}
+
+// Return the presence of a user, nil if it isn't known.
+func (t *PresenceTracker) Presence(gaiaId string) *UserPresence {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.presences[gaiaId]
+}
+
+// Return the users known to be reachable, sorted by gaia id.
+func (t *PresenceTracker) Online() []*UserPresence {
+	t.lock.Lock()
+	online := make([]*UserPresence, 0)
+	for _, presence := range t.presences {
+		if presence.Online() {
+			online = append(online, presence)
+		}
+	}
+	t.lock.Unlock()
+	sort.Sort(presencesByGaiaId(online))
+	return online
+}
+
+// Add users to the ones queried on every refresh.
+func (t *PresenceTracker) Watch(gaiaIds ...string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, gaiaId := range gaiaIds {
+		t.watched[gaiaId] = true
+	}
+}
+
+// Stop querying users. Their presence is still updated by notifications.
+func (t *PresenceTracker) Unwatch(gaiaIds ...string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, gaiaId := range gaiaIds {
+		delete(t.watched, gaiaId)
+	}
+}
+
+// Query the presence of the watched users now, one at a time as
+// QueryPresence takes a single user. The first error is returned after all
+// users were tried.
+func (t *PresenceTracker) Refresh() error {
+	t.lock.Lock()
+	gaiaIds := make([]string, 0, len(t.watched))
+	for gaiaId := range t.watched {
+		gaiaIds = append(gaiaIds, gaiaId)
+	}
+	t.lock.Unlock()
+	if len(gaiaIds) == 0 {
+		return nil
+	}
+	sort.Strings(gaiaIds)
+
+	var firstErr error
+	for _, gaiaId := range gaiaIds {
+		response, err := t.client.QueryPresence(gaiaId)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		t.Update(response.PresenceResult)
+	}
+	return firstErr
+}
+
+// Refresh the watched users now and then every RefreshInterval until Stop.
+// The error of the first refresh is returned, later ones are retried on
+// the next tick.
+func (t *PresenceTracker) Start() error {
+	t.refreshLock.Lock()
+	if t.refresh != nil {
+		t.refreshLock.Unlock()
+		return nil
+	}
+	interval := t.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultPresenceRefreshInterval
+	}
+	t.refresh = make(chan struct{})
+	go t.refreshLoop(t.refresh, interval)
+	t.refreshLock.Unlock()
+
+	// outside the lock, so handlers of the first refresh may call Stop
+	return t.Refresh()
+}
+
+// Stop refreshing the watched users.
+func (t *PresenceTracker) Stop() {
+	t.refreshLock.Lock()
+	defer t.refreshLock.Unlock()
+	if t.refresh != nil {
+		close(t.refresh)
+		t.refresh = nil
+	}
+}
+
+// Merge presence results into the known presences. Handlers are called for
+// the users whose presence changed.
+func (t *PresenceTracker) Update(results []*hangouts.PresenceResult) {
+	changes := make([]*PresenceChange, 0)
+	t.lock.Lock()
+	for _, result := range results {
+		gaiaId := result.UserId.GetGaiaId()
+		if gaiaId == "" || result.Presence == nil {
+			continue
+		}
+		previous := t.presences[gaiaId]
+		if previous == nil {
+			previous = &UserPresence{GaiaId: gaiaId}
+		}
+		current := previous.merge(result.Presence)
+		t.presences[gaiaId] = current
+		if current.differs(previous) {
+			changes = append(changes, &PresenceChange{Previous: previous, Current: current})
+		}
+	}
+	t.lock.Unlock()
+
+	t.handlersLock.RLock()
+	handlers := t.handlers
+	t.handlersLock.RUnlock()
+	for _, change := range changes {
+		for _, handler := range handlers {
+			(*handler)(change)
+		}
+	}
+}
+
+func (t *PresenceTracker) refreshLoop(done chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			t.Refresh()
+		}
+	}
+}
+
+type presencesByGaiaId []*UserPresence
+
+func (p presencesByGaiaId) Len() int           { return len(p) }
+func (p presencesByGaiaId) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p presencesByGaiaId) Less(i, j int) bool { return p[i].GaiaId < p[j].GaiaId }
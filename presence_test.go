@@ -0,0 +1,94 @@
+package hangups
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestPresenceTrackerRefreshQueriesOneUserAtATime(t *testing.T) {
+	var queried [][]string
+	api := newFakeApi(t, func(endpoint string, payload []byte) (proto.Message, error) {
+		request := &hangouts.QueryPresenceRequest{}
+		if err := proto.Unmarshal(payload, request); err != nil {
+			t.Errorf("bad %s request: %v", endpoint, err)
+		}
+		ids := make([]string, 0)
+		for _, participantId := range request.ParticipantId {
+			ids = append(ids, participantId.GetGaiaId())
+		}
+		queried = append(queried, ids)
+		if len(ids) != 1 || ids[0] == "2" {
+			return nil, errors.New("query failed")
+		}
+		return &hangouts.QueryPresenceResponse{PresenceResult: []*hangouts.PresenceResult{{
+			UserId:   request.ParticipantId[0],
+			Presence: &hangouts.Presence{Reachable: proto.Bool(true), Available: proto.Bool(true)},
+		}}}, nil
+	})
+	defer api.restore()
+
+	tracker := NewPresenceTracker(&Client{Session: &Session{}})
+	tracker.Watch("3", "1", "2")
+	if err := tracker.Refresh(); err == nil {
+		t.Error("Refresh succeeded though a query failed")
+	}
+	if want := [][]string{{"1"}, {"2"}, {"3"}}; !reflect.DeepEqual(queried, want) {
+		t.Errorf("queried %v, want %v", queried, want)
+	}
+	for _, gaiaId := range []string{"1", "3"} {
+		if presence := tracker.Presence(gaiaId); presence == nil || !presence.Online() {
+			t.Errorf("user %s isn't online after the refresh: %+v", gaiaId, presence)
+		}
+	}
+	if presence := tracker.Presence("2"); presence != nil {
+		t.Errorf("user 2 has a presence though its query failed: %+v", presence)
+	}
+}
+
+func TestPresenceTrackerRemoveChangeHandler(t *testing.T) {
+	tracker := NewPresenceTracker(&Client{})
+	defer tracker.Close()
+	kept, removed := 0, 0
+	tracker.AddChangeHandler(func(change *PresenceChange) { kept++ })
+	remove := tracker.AddChangeHandler(func(change *PresenceChange) { removed++ })
+	remove()
+	remove()
+
+	tracker.Update([]*hangouts.PresenceResult{{
+		UserId:   &hangouts.ParticipantId{GaiaId: proto.String("1")},
+		Presence: &hangouts.Presence{Reachable: proto.Bool(true)},
+	}})
+	if kept != 1 || removed != 0 {
+		t.Errorf("kept handler called %d times, removed one %d times, want 1 and 0", kept, removed)
+	}
+}
+
+func TestPresenceTrackerStopFromFirstRefresh(t *testing.T) {
+	api := newFakeApi(t, func(endpoint string, payload []byte) (proto.Message, error) {
+		return &hangouts.QueryPresenceResponse{PresenceResult: []*hangouts.PresenceResult{{
+			UserId:   &hangouts.ParticipantId{GaiaId: proto.String("1")},
+			Presence: &hangouts.Presence{Reachable: proto.Bool(true)},
+		}}}, nil
+	})
+	defer api.restore()
+
+	tracker := NewPresenceTracker(&Client{Session: &Session{}})
+	defer tracker.Close()
+	tracker.Watch("1")
+	tracker.AddChangeHandler(func(change *PresenceChange) { tracker.Stop() })
+	done := make(chan error, 1)
+	go func() { done <- tracker.Start() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start deadlocked when a handler called Stop")
+	}
+}
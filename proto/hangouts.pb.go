@@ -6,9 +6,11 @@
 Package hangouts is a generated protocol buffer package.
 
 It is generated from these files:
+
 	proto/hangouts.proto
 
 It has these top-level messages:
+
 	DoNotDisturbSetting
 	NotificationSettings
 	ConversationId
@@ -112,12 +114,18 @@ It has these top-level messages:
 	GetSuggestedEntitiesResponse
 	GetSelfInfoRequest
 	GetSelfInfoResponse
+	ModifyConversationViewRequest
+	ModifyConversationViewResponse
+	ModifyOTRStatusRequest
+	ModifyOTRStatusResponse
 	QueryPresenceRequest
 	QueryPresenceResponse
 	RemoveUserRequest
 	RemoveUserResponse
 	RenameConversationRequest
 	RenameConversationResponse
+	ReplyToInviteRequest
+	ReplyToInviteResponse
 	SearchEntitiesRequest
 	SearchEntitiesResponse
 	SendChatMessageRequest
@@ -126,6 +134,8 @@ It has these top-level messages:
 	SendOffnetworkInvitationResponse
 	SetActiveClientRequest
 	SetActiveClientResponse
+	SetBlockStateRequest
+	SetBlockStateResponse
 	SetConversationLevelRequest
 	SetConversationLevelResponse
 	SetConversationNotificationLevelRequest
@@ -1552,17 +1562,20 @@ type FieldMask int32
 const (
 	FieldMask_FIELD_MASK_REACHABLE FieldMask = 1
 	FieldMask_FIELD_MASK_AVAILABLE FieldMask = 2
+	FieldMask_FIELD_MASK_MOOD      FieldMask = 3
 	FieldMask_FIELD_MASK_DEVICE    FieldMask = 7
 )
 
 var FieldMask_name = map[int32]string{
 	1: "FIELD_MASK_REACHABLE",
 	2: "FIELD_MASK_AVAILABLE",
+	3: "FIELD_MASK_MOOD",
 	7: "FIELD_MASK_DEVICE",
 }
 var FieldMask_value = map[string]int32{
 	"FIELD_MASK_REACHABLE": 1,
 	"FIELD_MASK_AVAILABLE": 2,
+	"FIELD_MASK_MOOD":      3,
 	"FIELD_MASK_DEVICE":    7,
 }
 
@@ -5972,6 +5985,118 @@ func (m *GetSelfInfoResponse) GetDefaultCountry() *Country {
 	return nil
 }
 
+type ModifyConversationViewRequest struct {
+	RequestHeader      *RequestHeader    `protobuf:"bytes,1,opt,name=request_header" json:"request_header,omitempty"`
+	ConversationId     *ConversationId   `protobuf:"bytes,2,opt,name=conversation_id" json:"conversation_id,omitempty"`
+	NewView            *ConversationView `protobuf:"varint,3,opt,name=new_view,enum=ConversationView" json:"new_view,omitempty"`
+	LastEventTimestamp *uint64           `protobuf:"varint,4,opt,name=last_event_timestamp" json:"last_event_timestamp,omitempty"`
+	XXX_unrecognized   []byte            `json:"-"`
+}
+
+func (m *ModifyConversationViewRequest) Reset()         { *m = ModifyConversationViewRequest{} }
+func (m *ModifyConversationViewRequest) String() string { return proto.CompactTextString(m) }
+func (*ModifyConversationViewRequest) ProtoMessage()    {}
+
+func (m *ModifyConversationViewRequest) GetRequestHeader() *RequestHeader {
+	if m != nil {
+		return m.RequestHeader
+	}
+	return nil
+}
+
+func (m *ModifyConversationViewRequest) GetConversationId() *ConversationId {
+	if m != nil {
+		return m.ConversationId
+	}
+	return nil
+}
+
+func (m *ModifyConversationViewRequest) GetNewView() ConversationView {
+	if m != nil && m.NewView != nil {
+		return *m.NewView
+	}
+	return ConversationView_CONVERSATION_VIEW_UNKNOWN
+}
+
+func (m *ModifyConversationViewRequest) GetLastEventTimestamp() uint64 {
+	if m != nil && m.LastEventTimestamp != nil {
+		return *m.LastEventTimestamp
+	}
+	return 0
+}
+
+type ModifyConversationViewResponse struct {
+	ResponseHeader   *ResponseHeader `protobuf:"bytes,1,opt,name=response_header" json:"response_header,omitempty"`
+	XXX_unrecognized []byte          `json:"-"`
+}
+
+func (m *ModifyConversationViewResponse) Reset()         { *m = ModifyConversationViewResponse{} }
+func (m *ModifyConversationViewResponse) String() string { return proto.CompactTextString(m) }
+func (*ModifyConversationViewResponse) ProtoMessage()    {}
+
+func (m *ModifyConversationViewResponse) GetResponseHeader() *ResponseHeader {
+	if m != nil {
+		return m.ResponseHeader
+	}
+	return nil
+}
+
+type ModifyOTRStatusRequest struct {
+	RequestHeader      *RequestHeader      `protobuf:"bytes,1,opt,name=request_header" json:"request_header,omitempty"`
+	OtrStatus          *OffTheRecordStatus `protobuf:"varint,3,opt,name=otr_status,enum=OffTheRecordStatus" json:"otr_status,omitempty"`
+	EventRequestHeader *EventRequestHeader `protobuf:"bytes,5,opt,name=event_request_header" json:"event_request_header,omitempty"`
+	XXX_unrecognized   []byte              `json:"-"`
+}
+
+func (m *ModifyOTRStatusRequest) Reset()         { *m = ModifyOTRStatusRequest{} }
+func (m *ModifyOTRStatusRequest) String() string { return proto.CompactTextString(m) }
+func (*ModifyOTRStatusRequest) ProtoMessage()    {}
+
+func (m *ModifyOTRStatusRequest) GetRequestHeader() *RequestHeader {
+	if m != nil {
+		return m.RequestHeader
+	}
+	return nil
+}
+
+func (m *ModifyOTRStatusRequest) GetOtrStatus() OffTheRecordStatus {
+	if m != nil && m.OtrStatus != nil {
+		return *m.OtrStatus
+	}
+	return OffTheRecordStatus_OFF_THE_RECORD_STATUS_UNKNOWN
+}
+
+func (m *ModifyOTRStatusRequest) GetEventRequestHeader() *EventRequestHeader {
+	if m != nil {
+		return m.EventRequestHeader
+	}
+	return nil
+}
+
+type ModifyOTRStatusResponse struct {
+	ResponseHeader   *ResponseHeader `protobuf:"bytes,1,opt,name=response_header" json:"response_header,omitempty"`
+	CreatedEvent     *Event          `protobuf:"bytes,4,opt,name=created_event" json:"created_event,omitempty"`
+	XXX_unrecognized []byte          `json:"-"`
+}
+
+func (m *ModifyOTRStatusResponse) Reset()         { *m = ModifyOTRStatusResponse{} }
+func (m *ModifyOTRStatusResponse) String() string { return proto.CompactTextString(m) }
+func (*ModifyOTRStatusResponse) ProtoMessage()    {}
+
+func (m *ModifyOTRStatusResponse) GetResponseHeader() *ResponseHeader {
+	if m != nil {
+		return m.ResponseHeader
+	}
+	return nil
+}
+
+func (m *ModifyOTRStatusResponse) GetCreatedEvent() *Event {
+	if m != nil {
+		return m.CreatedEvent
+	}
+	return nil
+}
+
 type QueryPresenceRequest struct {
 	RequestHeader    *RequestHeader   `protobuf:"bytes,1,opt,name=request_header" json:"request_header,omitempty"`
 	ParticipantId    []*ParticipantId `protobuf:"bytes,2,rep,name=participant_id" json:"participant_id,omitempty"`
@@ -6132,6 +6257,54 @@ func (m *RenameConversationResponse) GetCreatedEvent() *Event {
 	return nil
 }
 
+type ReplyToInviteRequest struct {
+	RequestHeader     *RequestHeader     `protobuf:"bytes,1,opt,name=request_header" json:"request_header,omitempty"`
+	ConversationId    *ConversationId    `protobuf:"bytes,2,opt,name=conversation_id" json:"conversation_id,omitempty"`
+	ReplyToInviteType *ReplyToInviteType `protobuf:"varint,3,opt,name=reply_to_invite_type,enum=ReplyToInviteType" json:"reply_to_invite_type,omitempty"`
+	XXX_unrecognized  []byte             `json:"-"`
+}
+
+func (m *ReplyToInviteRequest) Reset()         { *m = ReplyToInviteRequest{} }
+func (m *ReplyToInviteRequest) String() string { return proto.CompactTextString(m) }
+func (*ReplyToInviteRequest) ProtoMessage()    {}
+
+func (m *ReplyToInviteRequest) GetRequestHeader() *RequestHeader {
+	if m != nil {
+		return m.RequestHeader
+	}
+	return nil
+}
+
+func (m *ReplyToInviteRequest) GetConversationId() *ConversationId {
+	if m != nil {
+		return m.ConversationId
+	}
+	return nil
+}
+
+func (m *ReplyToInviteRequest) GetReplyToInviteType() ReplyToInviteType {
+	if m != nil && m.ReplyToInviteType != nil {
+		return *m.ReplyToInviteType
+	}
+	return ReplyToInviteType_REPLY_TO_INVITE_TYPE_UNKNOWN
+}
+
+type ReplyToInviteResponse struct {
+	ResponseHeader   *ResponseHeader `protobuf:"bytes,1,opt,name=response_header" json:"response_header,omitempty"`
+	XXX_unrecognized []byte          `json:"-"`
+}
+
+func (m *ReplyToInviteResponse) Reset()         { *m = ReplyToInviteResponse{} }
+func (m *ReplyToInviteResponse) String() string { return proto.CompactTextString(m) }
+func (*ReplyToInviteResponse) ProtoMessage()    {}
+
+func (m *ReplyToInviteResponse) GetResponseHeader() *ResponseHeader {
+	if m != nil {
+		return m.ResponseHeader
+	}
+	return nil
+}
+
 type SearchEntitiesRequest struct {
 	RequestHeader    *RequestHeader `protobuf:"bytes,1,opt,name=request_header" json:"request_header,omitempty"`
 	Query            *string        `protobuf:"bytes,3,opt,name=query" json:"query,omitempty"`
@@ -6359,6 +6532,46 @@ func (m *SetActiveClientResponse) GetResponseHeader() *ResponseHeader {
 	return nil
 }
 
+type SetBlockStateRequest struct {
+	RequestHeader    *RequestHeader    `protobuf:"bytes,1,opt,name=request_header" json:"request_header,omitempty"`
+	BlockStateChange *BlockStateChange `protobuf:"bytes,2,opt,name=block_state_change" json:"block_state_change,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *SetBlockStateRequest) Reset()         { *m = SetBlockStateRequest{} }
+func (m *SetBlockStateRequest) String() string { return proto.CompactTextString(m) }
+func (*SetBlockStateRequest) ProtoMessage()    {}
+
+func (m *SetBlockStateRequest) GetRequestHeader() *RequestHeader {
+	if m != nil {
+		return m.RequestHeader
+	}
+	return nil
+}
+
+func (m *SetBlockStateRequest) GetBlockStateChange() *BlockStateChange {
+	if m != nil {
+		return m.BlockStateChange
+	}
+	return nil
+}
+
+type SetBlockStateResponse struct {
+	ResponseHeader   *ResponseHeader `protobuf:"bytes,1,opt,name=response_header" json:"response_header,omitempty"`
+	XXX_unrecognized []byte          `json:"-"`
+}
+
+func (m *SetBlockStateResponse) Reset()         { *m = SetBlockStateResponse{} }
+func (m *SetBlockStateResponse) String() string { return proto.CompactTextString(m) }
+func (*SetBlockStateResponse) ProtoMessage()    {}
+
+func (m *SetBlockStateResponse) GetResponseHeader() *ResponseHeader {
+	if m != nil {
+		return m.ResponseHeader
+	}
+	return nil
+}
+
 type SetConversationLevelRequest struct {
 	RequestHeader    *RequestHeader `protobuf:"bytes,1,opt,name=request_header" json:"request_header,omitempty"`
 	XXX_unrecognized []byte         `json:"-"`
@@ -0,0 +1,177 @@
+package hangups
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Rendering
+*
+* Turns received message content into plain text, Markdown or HTML.
+* Attachments (photos and places) are appended after the text, one per line.
+ */
+
+// Render message content as plain text. Links whose text differs from their
+// target are written as "text (target)".
+func RenderText(content *hangouts.MessageContent) string {
+	var out bytes.Buffer
+	for _, segment := range content.GetSegment() {
+		switch segment.GetType() {
+		case hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK:
+			out.WriteString("\n")
+		case hangouts.SegmentType_SEGMENT_TYPE_LINK:
+			text := segment.GetText()
+			target := segment.LinkData.GetLinkTarget()
+			out.WriteString(text)
+			if target != "" && target != text {
+				out.WriteString(" (" + target + ")")
+			}
+		default:
+			out.WriteString(segment.GetText())
+		}
+	}
+	for _, attachment := range Attachments(content) {
+		text := attachmentText(attachment)
+		if text == "" {
+			continue
+		}
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(text)
+	}
+	return out.String()
+}
+
+// Render message content as Markdown. See SegmentsMarkdown.
+func RenderMarkdown(content *hangouts.MessageContent) string {
+	var out bytes.Buffer
+	out.WriteString(SegmentsMarkdown(content.GetSegment()))
+	for _, attachment := range Attachments(content) {
+		markdown := ""
+		switch attachment := attachment.(type) {
+		case *PhotoAttachment:
+			if imageUrl := attachment.MediaUrl(); imageUrl != "" {
+				markdown = "![photo](" + escapeMarkdownTarget(imageUrl) + ")"
+				if attachment.PageUrl != "" && attachment.PageUrl != imageUrl {
+					markdown = "[" + markdown + "](" + escapeMarkdownTarget(attachment.PageUrl) + ")"
+				}
+			}
+		case *PlaceAttachment:
+			if attachment.Url != "" {
+				markdown = "[" + EscapeMarkdown(placeName(attachment)) + "](" + escapeMarkdownTarget(attachment.Url) + ")"
+			}
+		}
+		if markdown == "" {
+			continue
+		}
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(markdown)
+	}
+	return out.String()
+}
+
+// Render message content as HTML. All text is escaped and only http(s) and
+// mailto links are kept, so the result is safe to embed in a page.
+func RenderHTML(content *hangouts.MessageContent) string {
+	var out bytes.Buffer
+	for _, segment := range content.GetSegment() {
+		if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK {
+			out.WriteString("<br>\n")
+			continue
+		}
+		text := html.EscapeString(segment.GetText())
+		open, close := htmlFormatTags(FormatOf(segment.Formatting))
+		text = open + text + close
+		if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINK {
+			if target := safeUrl(segment.LinkData.GetLinkTarget()); target != "" {
+				text = `<a href="` + html.EscapeString(target) + `">` + text + `</a>`
+			}
+		}
+		out.WriteString(text)
+	}
+	for _, attachment := range Attachments(content) {
+		attachmentHTML := ""
+		switch attachment := attachment.(type) {
+		case *PhotoAttachment:
+			imageUrl := safeUrl(attachment.ThumbnailUrl)
+			if imageUrl == "" {
+				imageUrl = safeUrl(attachment.MediaUrl())
+			}
+			if imageUrl != "" {
+				attachmentHTML = `<img src="` + html.EscapeString(imageUrl) + `" alt="photo">`
+				if pageUrl := safeUrl(attachment.PageUrl); pageUrl != "" {
+					attachmentHTML = `<a href="` + html.EscapeString(pageUrl) + `">` + attachmentHTML + `</a>`
+				}
+			}
+		case *PlaceAttachment:
+			if placeUrl := safeUrl(attachment.Url); placeUrl != "" {
+				attachmentHTML = `<a href="` + html.EscapeString(placeUrl) + `">` + html.EscapeString(placeName(attachment)) + `</a>`
+			}
+		}
+		if attachmentHTML == "" {
+			continue
+		}
+		if out.Len() > 0 {
+			out.WriteString("<br>\n")
+		}
+		out.WriteString(attachmentHTML)
+	}
+	return out.String()
+}
+
+// Plain text for an attachment: the photo url, or the place name and url.
+func attachmentText(attachment Attachment) string {
+	switch attachment := attachment.(type) {
+	case *PhotoAttachment:
+		if imageUrl := attachment.MediaUrl(); imageUrl != "" {
+			return imageUrl
+		}
+		return attachment.PageUrl
+	case *PlaceAttachment:
+		return strings.TrimSpace(attachment.Name + " " + attachment.Url)
+	}
+	return ""
+}
+
+func placeName(place *PlaceAttachment) string {
+	if place.Name == "" {
+		return "Map"
+	}
+	return place.Name
+}
+
+func htmlFormatTags(format Format) (open, close string) {
+	tags := []struct {
+		flag Format
+		tag  string
+	}{{Bold, "b"}, {Italic, "i"}, {Strikethrough, "s"}, {Underline, "u"}}
+	for _, tag := range tags {
+		if format&tag.flag != 0 {
+			open = open + "<" + tag.tag + ">"
+			close = "</" + tag.tag + ">" + close
+		}
+	}
+	return open, close
+}
+
+// Return rawUrl if it is a http(s) or mailto url, else an empty string.
+// Keeps javascript: and similar links out of rendered HTML.
+func safeUrl(rawUrl string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return parsed.String()
+	}
+	return ""
+}
@@ -0,0 +1,299 @@
+package hangups
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Self Info
+*
+* GetSelfInfo returns the current user's profile along with the account
+* settings: do not disturb, desktop off, phones, sounds, rich presence, etc.
+* SelfInfo wraps the response with typed accessors and applies the
+* SelfPresence, SetNotificationSetting and RichPresenceEnabledState
+* notifications the client processes to it, so it always reflects the
+* current settings.
+ */
+
+// Called after SelfInfo was changed by a notification.
+type SelfInfoChangeHandler func(info *SelfInfo, update *hangouts.StateUpdate)
+
+// The current user and their account settings, safe for concurrent use.
+type SelfInfo struct {
+	removeHandler func() // removes the StateUpdate handler, see Close
+
+	// the latest GetSelfInfo response with the notifications applied,
+	// replaced rather than modified
+	response      *hangouts.GetSelfInfoResponse
+	presenceState hangouts.ClientPresenceStateType
+	mood          *hangouts.MoodContent
+	lock          sync.RWMutex
+
+	handlers     []*SelfInfoChangeHandler // by pointer, so they can be removed
+	handlersLock sync.RWMutex
+}
+
+// Create a SelfInfo from a GetSelfInfo response, kept up to date with the
+// notifications the client processes.
+func NewSelfInfo(c *Client, response *hangouts.GetSelfInfoResponse) *SelfInfo {
+	if response == nil {
+		response = &hangouts.GetSelfInfoResponse{}
+	}
+	info := &SelfInfo{response: response}
+	info.removeHandler = c.AddStateUpdateHandler(info.processStateUpdate)
+	return info
+}
+
+// Call GetSelfInfo and return the result as a SelfInfo.
+func (c *Client) SyncSelfInfo() (*SelfInfo, error) {
+	response, err := c.GetSelfInfo()
+	if err != nil {
+		return nil, err
+	}
+	return NewSelfInfo(c, response), nil
+}
+
+// Register a handler to be called after a notification changed the info.
+// Call the returned function to remove it.
+func (info *SelfInfo) AddChangeHandler(handler SelfInfoChangeHandler) func() {
+	entry := &handler
+	info.handlersLock.Lock()
+	defer info.handlersLock.Unlock()
+	info.handlers = append(info.handlers, entry)
+	return func() {
+		info.handlersLock.Lock()
+		defer info.handlersLock.Unlock()
+		handlers := make([]*SelfInfoChangeHandler, 0, len(info.handlers))
+		for _, registered := range info.handlers {
+			if registered != entry {
+				handlers = append(handlers, registered)
+			}
+		}
+		info.handlers = handlers
+	}
+}
+
+// Stop applying the notifications the client processes.
+func (info *SelfInfo) Close() {
+	info.removeHandler()
+}
+
+// Return the underlying GetSelfInfo response, with the notifications
+// received since applied. It must not be modified.
+func (info *SelfInfo) Response() *hangouts.GetSelfInfoResponse {
+	info.lock.RLock()
+	defer info.lock.RUnlock()
+	return info.response
+}
+
+// Return the current user's entity.
+func (info *SelfInfo) Entity() *hangouts.Entity {
+	return info.Response().GetSelfEntity()
+}
+
+// Return the current user's gaia id.
+func (info *SelfInfo) GaiaId() string {
+	return info.Entity().GetId().GetGaiaId()
+}
+
+// Return the current user's display name.
+func (info *SelfInfo) DisplayName() string {
+	return info.Entity().GetProperties().GetDisplayName()
+}
+
+// Return the current user's primary email, "" if unknown.
+func (info *SelfInfo) Email() string {
+	emails := info.Entity().GetProperties().GetEmail()
+	if len(emails) == 0 {
+		return ""
+	}
+	return emails[0]
+}
+
+// Report whether the account is known to belong to a minor.
+func (info *SelfInfo) IsKnownMinor() bool {
+	return info.Response().GetIsKnownMinor()
+}
+
+// Report whether the account is a Google+ account.
+func (info *SelfInfo) IsGooglePlusUser() bool {
+	return info.Response().GetGooglePlusUser()
+}
+
+// Report whether do not disturb is on and hasn't expired.
+func (info *SelfInfo) DoNotDisturb() bool {
+	dnd := info.Response().GetDndState()
+	if !dnd.GetDoNotDisturb() {
+		return false
+	}
+	return dnd.GetExpirationTimestamp() == 0 || time.Now().Before(usecsToTime(dnd.GetExpirationTimestamp()))
+}
+
+// Return when do not disturb expires, the zero time if it is off or doesn't
+// expire.
+func (info *SelfInfo) DoNotDisturbUntil() time.Time {
+	dnd := info.Response().GetDndState()
+	if !dnd.GetDoNotDisturb() || dnd.GetExpirationTimestamp() == 0 {
+		return time.Time{}
+	}
+	return usecsToTime(dnd.GetExpirationTimestamp())
+}
+
+// Report whether Hangouts is signed off on desktop. The state wins over the
+// setting when the server reported both.
+func (info *SelfInfo) DesktopOff() bool {
+	response := info.Response()
+	if state := response.GetDesktopOffState(); state != nil && state.DesktopOff != nil {
+		return state.GetDesktopOff()
+	}
+	return response.GetDesktopOffSetting().GetDesktopOff()
+}
+
+// Report whether a sound is played for incoming messages on desktop.
+func (info *SelfInfo) DesktopSound() bool {
+	return info.Response().GetDesktopSoundSetting().GetDesktopSoundState() == hangouts.SoundState_SOUND_STATE_ON
+}
+
+// Report whether desktop rings for incoming calls.
+func (info *SelfInfo) DesktopRingSound() bool {
+	return info.Response().GetDesktopSoundSetting().GetDesktopRingSoundState() == hangouts.SoundState_SOUND_STATE_ON
+}
+
+// Return the account's phones.
+func (info *SelfInfo) Phones() []*hangouts.Phone {
+	return info.Response().GetPhoneData().GetPhone()
+}
+
+// Return the account's primary phone number in E.164 format ("+15551234567"),
+// "" if none.
+func (info *SelfInfo) PrimaryPhone() string {
+	for _, phone := range info.Phones() {
+		if phone.GetPrimary() {
+			return phone.GetPhoneNumber().GetE164()
+		}
+	}
+	return ""
+}
+
+// Return the caller id settings of the account's phones.
+func (info *SelfInfo) CallerIdSettings() hangouts.CallerIdSettingsMask {
+	return info.Response().GetPhoneData().GetCallerIdSettingsMask()
+}
+
+// Return the value of a configuration bit, and whether it was set.
+func (info *SelfInfo) ConfigurationBit(bitType hangouts.ConfigurationBitType) (bool, bool) {
+	for _, bit := range info.Response().GetConfigurationBit() {
+		if bit.GetConfigurationBitType() == bitType {
+			return bit.GetValue(), true
+		}
+	}
+	return false, false
+}
+
+// Report whether a kind of rich presence is shared.
+func (info *SelfInfo) RichPresenceEnabled(richPresenceType hangouts.RichPresenceType) bool {
+	for _, state := range info.Response().GetRichPresenceState().GetGetRichPresenceEnabledState() {
+		if state.GetType() == richPresenceType {
+			return state.GetEnabled()
+		}
+	}
+	return false
+}
+
+// Return the account's default country as a region code ("CA") and calling
+// code (1).
+func (info *SelfInfo) DefaultCountry() (string, uint64) {
+	country := info.Response().GetDefaultCountry()
+	return country.GetRegionCode(), country.GetCountryCode()
+}
+
+// Return the presence state of the current user's clients, from the last
+// SelfPresenceNotification, CLIENT_PRESENCE_STATE_UNKNOWN before that.
+func (info *SelfInfo) PresenceState() hangouts.ClientPresenceStateType {
+	info.lock.RLock()
+	defer info.lock.RUnlock()
+	return info.presenceState
+}
+
+// Return the current user's mood message from the last
+// SelfPresenceNotification, nil if none is known.
+func (info *SelfInfo) Mood() *hangouts.MoodContent {
+	info.lock.RLock()
+	defer info.lock.RUnlock()
+	return info.mood
+}
+
+func (info *SelfInfo) processStateUpdate(update *hangouts.StateUpdate) {
+	selfPresence := update.GetSelfPresenceNotification()
+	notificationSetting := update.GetNotificationSettingNotification()
+	richPresence := update.GetRichPresenceEnabledStateNotification()
+	if selfPresence == nil && notificationSetting == nil && richPresence == nil {
+		return
+	}
+
+	info.lock.Lock()
+	response := proto.Clone(info.response).(*hangouts.GetSelfInfoResponse)
+	if selfPresence != nil {
+		if selfPresence.ClientPresenceState != nil {
+			info.presenceState = selfPresence.ClientPresenceState.GetState()
+		}
+		if selfPresence.DoNotDisturbSetting != nil {
+			response.DndState = selfPresence.DoNotDisturbSetting
+		}
+		if selfPresence.DesktopOffSetting != nil {
+			response.DesktopOffSetting = selfPresence.DesktopOffSetting
+		}
+		if selfPresence.DesktopOffState != nil {
+			response.DesktopOffState = selfPresence.DesktopOffState
+		}
+		if selfPresence.MoodState != nil {
+			info.mood = selfPresence.MoodState.GetMoodSetting().GetMoodMessage().GetMoodContent()
+		}
+	}
+	if setting := notificationSetting.GetDesktopSoundSetting(); setting != nil {
+		if response.DesktopSoundSetting == nil {
+			response.DesktopSoundSetting = &hangouts.DesktopSoundSetting{}
+		}
+		if setting.DesktopSoundState != nil {
+			response.DesktopSoundSetting.DesktopSoundState = setting.DesktopSoundState
+		}
+		if setting.DesktopRingSoundState != nil {
+			response.DesktopSoundSetting.DesktopRingSoundState = setting.DesktopRingSoundState
+		}
+	}
+	for _, state := range richPresence.GetRichPresenceEnabledState() {
+		if response.RichPresenceState == nil {
+			response.RichPresenceState = &hangouts.RichPresenceState{}
+		}
+		setRichPresenceEnabledState(response.RichPresenceState, state)
+	}
+	info.response = response
+	info.lock.Unlock()
+
+	info.handlersLock.RLock()
+	handlers := info.handlers
+	info.handlersLock.RUnlock()
+	for _, handler := range handlers {
+		(*handler)(info, update)
+	}
+}
+
+// Replace the enabled state of a kind of rich presence, or add it.
+func setRichPresenceEnabledState(richPresenceState *hangouts.RichPresenceState, state *hangouts.RichPresenceEnabledState) {
+	for ind, existing := range richPresenceState.GetRichPresenceEnabledState {
+		if existing.GetType() == state.GetType() {
+			richPresenceState.GetRichPresenceEnabledState[ind] = state
+			return
+		}
+	}
+	richPresenceState.GetRichPresenceEnabledState = append(richPresenceState.GetRichPresenceEnabledState, state)
+}
+
+// Convert a timestamp in microseconds since the epoch, as used by the api.
+func usecsToTime(usecs uint64) time.Time {
+	return time.Unix(0, int64(usecs)*int64(time.Microsecond))
+}
@@ -0,0 +1,32 @@
+package hangups
+
+import (
+	"testing"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestSelfInfoRemoveChangeHandler(t *testing.T) {
+	info := NewSelfInfo(&Client{}, nil)
+	defer info.Close()
+	kept, removed := 0, 0
+	info.AddChangeHandler(func(info *SelfInfo, update *hangouts.StateUpdate) { kept++ })
+	remove := info.AddChangeHandler(func(info *SelfInfo, update *hangouts.StateUpdate) { removed++ })
+	remove()
+	remove()
+
+	state := hangouts.ClientPresenceStateType_CLIENT_PRESENCE_STATE_DESKTOP_ACTIVE
+	info.processStateUpdate(&hangouts.StateUpdate{
+		StateUpdate: &hangouts.StateUpdate_SelfPresenceNotification{
+			SelfPresenceNotification: &hangouts.SelfPresenceNotification{
+				ClientPresenceState: &hangouts.ClientPresenceState{State: &state},
+			},
+		},
+	})
+	if kept != 1 || removed != 0 {
+		t.Errorf("kept handler called %d times, removed one %d times, want 1 and 0", kept, removed)
+	}
+	if got := info.PresenceState(); got != state {
+		t.Errorf("PresenceState() = %v, want %v", got, state)
+	}
+}
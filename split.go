@@ -0,0 +1,262 @@
+package hangups
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Message Splitting
+*
+* Long messages are split into parts that are sent one after the other.
+* Parts are cut at line breaks when possible, then between segments, then at
+* whitespace inside a text segment and only as a last resort between two
+* characters. Links are never cut: a link longer than the limit is sent as a
+* part of its own.
+ */
+
+// Default length limit of a message part, in characters.
+const DefaultMaxMessageLength = 2000
+
+// How SendSplitMessage cuts a message.
+type SplitOptions struct {
+	// Longest part in characters, DefaultMaxMessageLength when zero.
+	MaxLength int
+	// Append " (1/3)" style markers to the parts of split messages.
+	Markers bool
+}
+
+// Split segments into parts of at most maxLength characters each, line
+// breaks counting as one. Formatting is kept on both sides of a cut.
+func SplitSegments(segments []*hangouts.Segment, maxLength int) [][]*hangouts.Segment {
+	splitter := &segmentSplitter{maxLength: maxLength, parts: make([][]*hangouts.Segment, 0)}
+	if maxLength <= 0 {
+		splitter.parts = append(splitter.parts, segments)
+		return splitter.parts
+	}
+	for _, line := range segmentLines(segments) {
+		splitter.addLine(line)
+	}
+	splitter.flush()
+	return splitter.parts
+}
+
+// Split message content as SplitSegments does, optionally appending
+// " (1/3)" markers. Attachments go with the first part. Fails if the
+// markers leave no room for text.
+func SplitMessageContent(content *hangouts.MessageContent, options *SplitOptions) ([]*hangouts.MessageContent, error) {
+	if options == nil {
+		options = &SplitOptions{}
+	}
+	maxLength := options.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxMessageLength
+	}
+
+	parts := SplitSegments(content.GetSegment(), maxLength)
+	if options.Markers && len(parts) > 1 {
+		// make room for the markers, which can push the count of parts up
+		// and with it the length of the markers
+		reserve := 0
+		for {
+			marker := utf8.RuneCountInString(partMarker(len(parts), len(parts)))
+			if maxLength <= marker {
+				return nil, fmt.Errorf("No room for text beside the %q marker in parts of %d characters",
+					partMarker(len(parts), len(parts)), maxLength)
+			}
+			if marker <= reserve {
+				break
+			}
+			reserve = marker
+			parts = SplitSegments(content.GetSegment(), maxLength-reserve)
+		}
+		for ind := range parts {
+			marker := textPiece(&hangouts.Segment{Type: hangouts.SegmentType_SEGMENT_TYPE_TEXT.Enum()}, partMarker(ind+1, len(parts)))
+			parts[ind] = append(parts[ind], marker)
+		}
+	}
+
+	contents := make([]*hangouts.MessageContent, len(parts))
+	for ind, part := range parts {
+		contents[ind] = &hangouts.MessageContent{Segment: part}
+	}
+	if len(contents) > 0 {
+		contents[0].Attachment = content.GetAttachment()
+	}
+	return contents, nil
+}
+
+// Send message content split into parts (see SplitMessageContent), in
+// order, each as its own event with its own client generated id. Stops at
+// the first failure and returns the responses of the parts sent so far
+// with the error.
+func (c *Client) SendSplitMessage(conversationId string, content *hangouts.MessageContent, options *SplitOptions) ([]*hangouts.SendChatMessageResponse, error) {
+	parts, err := SplitMessageContent(content, options)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]*hangouts.SendChatMessageResponse, 0)
+	for _, part := range parts {
+		response, err := c.SendMessage(conversationId, part)
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func partMarker(part, parts int) string {
+	return fmt.Sprintf(" (%d/%d)", part, parts)
+}
+
+type segmentSplitter struct {
+	maxLength     int
+	parts         [][]*hangouts.Segment
+	current       []*hangouts.Segment
+	currentLength int
+}
+
+// Add a line, joining it to the current part with a line break if it fits
+// there, else starting a new part.
+func (s *segmentSplitter) addLine(line []*hangouts.Segment) {
+	lineLength := 0
+	for _, segment := range line {
+		lineLength += segmentLength(segment)
+	}
+	separator := 0
+	if len(s.current) > 0 {
+		separator = 1
+	}
+	if s.currentLength+separator+lineLength <= s.maxLength {
+		if separator > 0 {
+			s.add(NewMessageBuilder().LineBreak().Build()[0])
+		}
+		s.current = append(s.current, line...)
+		s.currentLength += lineLength
+		return
+	}
+
+	s.flush()
+	for _, segment := range line {
+		s.addSegment(segment)
+	}
+}
+
+// Add a segment of an overlong line, cutting text segments where needed.
+func (s *segmentSplitter) addSegment(segment *hangouts.Segment) {
+	length := segmentLength(segment)
+	if s.currentLength+length <= s.maxLength {
+		s.add(segment)
+		return
+	}
+	if segment.GetType() != hangouts.SegmentType_SEGMENT_TYPE_TEXT {
+		// links go whole into a part of their own if needed
+		s.flush()
+		s.add(segment)
+		return
+	}
+
+	rest := segment.GetText()
+	for rest != "" {
+		if s.currentLength >= s.maxLength {
+			s.flush()
+		}
+		if len(s.current) == 0 {
+			// don't start a part with the whitespace left over from a cut
+			if rest = strings.TrimLeftFunc(rest, unicode.IsSpace); rest == "" {
+				break
+			}
+		}
+		head, tail := cutText(rest, s.maxLength-s.currentLength, s.currentLength == 0)
+		if head == "" && tail == rest {
+			// no whitespace to cut at, move on to a fresh part
+			s.flush()
+			continue
+		}
+		if head != "" {
+			s.add(textPiece(segment, head))
+		}
+		rest = tail
+		if rest != "" {
+			s.flush()
+		}
+	}
+}
+
+func (s *segmentSplitter) add(segment *hangouts.Segment) {
+	s.current = append(s.current, segment)
+	s.currentLength += segmentLength(segment)
+}
+
+func (s *segmentSplitter) flush() {
+	// a blank line can leave a dangling line break
+	for last := len(s.current) - 1; last >= 0 && s.current[last].GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK; last-- {
+		s.current = s.current[:last]
+	}
+	if len(s.current) > 0 {
+		s.parts = append(s.parts, s.current)
+	}
+	s.current = nil
+	s.currentLength = 0
+}
+
+// Cut text to at most room characters, at the last whitespace that fits.
+// Without whitespace the cut falls between two characters if hardCut is
+// set, else nothing is cut off. The whitespace at the cut is dropped.
+func cutText(text string, room int, hardCut bool) (head, tail string) {
+	if utf8.RuneCountInString(text) <= room {
+		return text, ""
+	}
+	// byte offset just past the room-th character
+	offset := 0
+	for count := 0; count < room; count++ {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+	}
+	// whitespace right after the limit still makes a clean cut
+	limit := offset
+	if r, size := utf8.DecodeRuneInString(text[offset:]); unicode.IsSpace(r) {
+		limit += size
+	}
+	if cut := strings.LastIndexFunc(text[:limit], unicode.IsSpace); cut > 0 {
+		_, size := utf8.DecodeRuneInString(text[cut:])
+		return text[:cut], text[cut+size:]
+	}
+	if !hardCut {
+		return "", text
+	}
+	return text[:offset], text[offset:]
+}
+
+// Split segments into lines at line break segments, dropping the breaks.
+func segmentLines(segments []*hangouts.Segment) [][]*hangouts.Segment {
+	lines := [][]*hangouts.Segment{{}}
+	for _, segment := range segments {
+		if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK {
+			lines = append(lines, []*hangouts.Segment{})
+			continue
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], segment)
+	}
+	return lines
+}
+
+func segmentLength(segment *hangouts.Segment) int {
+	if segment.GetType() == hangouts.SegmentType_SEGMENT_TYPE_LINE_BREAK {
+		return 1
+	}
+	return utf8.RuneCountInString(segment.GetText())
+}
+
+// Copy of segment with its text replaced.
+func textPiece(segment *hangouts.Segment, text string) *hangouts.Segment {
+	piece := proto.Clone(segment).(*hangouts.Segment)
+	piece.Text = &text
+	return piece
+}
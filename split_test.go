@@ -0,0 +1,42 @@
+package hangups
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessageContentMarkers(t *testing.T) {
+	content := NewMessageBuilder().Text(strings.Repeat("word ", 40)).MessageContent()
+	tests := []struct {
+		maxLength int
+		wantErr   bool
+	}{
+		{30, false},
+		{12, false},
+		{7, true}, // " (1/n)" alone fills the part
+		{3, true},
+	}
+	for _, test := range tests {
+		parts, err := SplitMessageContent(content, &SplitOptions{MaxLength: test.maxLength, Markers: true})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("MaxLength %d: split into %d parts, want an error", test.maxLength, len(parts))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MaxLength %d: %v", test.maxLength, err)
+			continue
+		}
+		for ind, part := range parts {
+			text := RenderText(part)
+			if length := utf8.RuneCountInString(text); length > test.maxLength {
+				t.Errorf("MaxLength %d: part %d %q has %d characters", test.maxLength, ind+1, text, length)
+			}
+			if !strings.HasSuffix(text, partMarker(ind+1, len(parts))) {
+				t.Errorf("MaxLength %d: part %d %q lacks its marker", test.maxLength, ind+1, text)
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package hangups
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Typing
+*
+* Clients announce typing with SetTyping and repeat STARTED while the user
+* keeps typing; a status that isn't repeated goes stale after TypingTimeout.
+* TypingTracker collects the SetTypingNotifications the client processes,
+* and TypingSender sends the self user's typing status for a conversation.
+ */
+
+// Time after which a typing status that wasn't repeated is considered stopped.
+const TypingTimeout = 15 * time.Second
+
+// Interval at which TypingSender repeats STARTED while typing.
+const TypingRefreshInterval = 10 * time.Second
+
+// The typing status of a user in a conversation.
+type TypingStatus struct {
+	ConversationId string
+	GaiaId         string
+	// TYPING_TYPE_STARTED or TYPING_TYPE_PAUSED, or TYPING_TYPE_STOPPED in
+	// changes once the user stopped or the status expired.
+	Type hangouts.TypingType
+	// When the status was received.
+	Updated time.Time
+}
+
+// Called when a user's typing status changes.
+type TypingChangeHandler func(status *TypingStatus)
+
+// Tracks who is typing in which conversation, safe for concurrent use.
+type TypingTracker struct {
+	removeHandler func() // removes the StateUpdate handler, see Close
+
+	// Age after which a status expires, TypingTimeout when zero.
+	Timeout time.Duration
+
+	// typing statuses by conversation id, then gaia id
+	statuses     map[string]map[string]*TypingStatus
+	statusesLock sync.Mutex
+
+	handlers     []*TypingChangeHandler // by pointer, so they can be removed
+	handlersLock sync.RWMutex
+}
+
+// Create a tracker fed by the SetTypingNotifications the client processes.
+func NewTypingTracker(c *Client) *TypingTracker {
+	tracker := &TypingTracker{statuses: make(map[string]map[string]*TypingStatus)}
+	tracker.removeHandler = c.AddStateUpdateHandler(func(update *hangouts.StateUpdate) {
+		if notification := update.GetTypingNotification(); notification != nil {
+			tracker.Update(notification.ConversationId.GetId(), notification.SenderId.GetGaiaId(), notification.GetType())
+		}
+	})
+	return tracker
+}
+
+// Register a handler to be called for every typing status change,
+// including expiries. Call the returned function to remove it.
+func (t *TypingTracker) AddChangeHandler(handler TypingChangeHandler) func() {
+	entry := &handler
+	t.handlersLock.Lock()
+	defer t.handlersLock.Unlock()
+	t.handlers = append(t.handlers, entry)
+	return func() {
+		t.handlersLock.Lock()
+		defer t.handlersLock.Unlock()
+		handlers := make([]*TypingChangeHandler, 0, len(t.handlers))
+		for _, registered := range t.handlers {
+			if registered != entry {
+				handlers = append(handlers, registered)
+			}
+		}
+		t.handlers = handlers
+	}
+}
+
+// Stop following the SetTypingNotifications the client processes.
+func (t *TypingTracker) Close() {
+	t.removeHandler()
+}
+
+// Return the users typing (or paused) in a conversation, sorted by gaia id.
+func (t *TypingTracker) Typing(conversationId string) []*TypingStatus {
+	t.statusesLock.Lock()
+	defer t.statusesLock.Unlock()
+	typing := make([]*TypingStatus, 0)
+	for _, status := range t.statuses[conversationId] {
+		typing = append(typing, status)
+	}
+	sort.Sort(typingByGaiaId(typing))
+	return typing
+}
+
+// Record a user's typing status. Handlers are called if it changed.
+func (t *TypingTracker) Update(conversationId, gaiaId string, typingType hangouts.TypingType) {
+	status := &TypingStatus{ConversationId: conversationId, GaiaId: gaiaId, Type: typingType, Updated: time.Now()}
+
+	t.statusesLock.Lock()
+	previous := t.statuses[conversationId][gaiaId]
+	if typingType == hangouts.TypingType_TYPING_TYPE_STOPPED {
+		delete(t.statuses[conversationId], gaiaId)
+		if len(t.statuses[conversationId]) == 0 {
+			delete(t.statuses, conversationId)
+		}
+	} else {
+		if t.statuses[conversationId] == nil {
+			t.statuses[conversationId] = make(map[string]*TypingStatus)
+		}
+		t.statuses[conversationId][gaiaId] = status
+		timeout := t.Timeout
+		if timeout <= 0 {
+			timeout = TypingTimeout
+		}
+		time.AfterFunc(timeout, func() { t.expire(status) })
+	}
+	t.statusesLock.Unlock()
+
+	changed := previous == nil && typingType != hangouts.TypingType_TYPING_TYPE_STOPPED ||
+		previous != nil && previous.Type != typingType
+	if changed {
+		t.notify(status)
+	}
+}
+
+// Drop a status that hasn't been replaced since it was set.
+func (t *TypingTracker) expire(status *TypingStatus) {
+	t.statusesLock.Lock()
+	if t.statuses[status.ConversationId][status.GaiaId] != status {
+		t.statusesLock.Unlock()
+		return
+	}
+	delete(t.statuses[status.ConversationId], status.GaiaId)
+	if len(t.statuses[status.ConversationId]) == 0 {
+		delete(t.statuses, status.ConversationId)
+	}
+	t.statusesLock.Unlock()
+
+	t.notify(&TypingStatus{
+		ConversationId: status.ConversationId,
+		GaiaId:         status.GaiaId,
+		Type:           hangouts.TypingType_TYPING_TYPE_STOPPED,
+		Updated:        time.Now(),
+	})
+}
+
+func (t *TypingTracker) notify(status *TypingStatus) {
+	t.handlersLock.RLock()
+	handlers := t.handlers
+	t.handlersLock.RUnlock()
+	for _, handler := range handlers {
+		(*handler)(status)
+	}
+}
+
+type typingByGaiaId []*TypingStatus
+
+func (s typingByGaiaId) Len() int           { return len(s) }
+func (s typingByGaiaId) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s typingByGaiaId) Less(i, j int) bool { return s[i].GaiaId < s[j].GaiaId }
+
+// Sends the self user's typing status for a conversation. Start can be
+// called on every keystroke: STARTED is only sent when the status changes,
+// and is then repeated in the background until Pause or Stop so the status
+// doesn't expire during a long reply.
+//
+//	typing := client.NewTypingSender(conversationId)
+//	typing.Start()
+//	reply := slowReply()
+//	typing.Stop()
+//	client.SendChatMessage(conversationId, reply)
+type TypingSender struct {
+	client         *Client
+	conversationId string
+
+	// Interval at which STARTED is repeated, TypingRefreshInterval when zero.
+	RefreshInterval time.Duration
+
+	state   hangouts.TypingType
+	refresh chan struct{} // closed to stop the refresh loop
+	lock    sync.Mutex
+}
+
+// Create a typing sender for a conversation.
+func (c *Client) NewTypingSender(conversationId string) *TypingSender {
+	return &TypingSender{client: c, conversationId: conversationId, state: hangouts.TypingType_TYPING_TYPE_STOPPED}
+}
+
+// Announce that the self user is typing, and keep announcing it until Pause
+// or Stop.
+func (s *TypingSender) Start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.state == hangouts.TypingType_TYPING_TYPE_STARTED {
+		return nil
+	}
+	if err := s.send(hangouts.TypingType_TYPING_TYPE_STARTED); err != nil {
+		return err
+	}
+	interval := s.RefreshInterval
+	if interval <= 0 {
+		interval = TypingRefreshInterval
+	}
+	s.refresh = make(chan struct{})
+	go s.refreshLoop(s.refresh, interval)
+	return nil
+}
+
+// Announce that the self user stopped typing with text entered.
+func (s *TypingSender) Pause() error {
+	return s.set(hangouts.TypingType_TYPING_TYPE_PAUSED)
+}
+
+// Announce that the self user stopped typing and cleared the text.
+func (s *TypingSender) Stop() error {
+	return s.set(hangouts.TypingType_TYPING_TYPE_STOPPED)
+}
+
+func (s *TypingSender) set(typingType hangouts.TypingType) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.state == typingType {
+		return nil
+	}
+	// on failure the previous status stands, and STARTED keeps being
+	// repeated if that was it
+	if err := s.send(typingType); err != nil {
+		return err
+	}
+	if s.refresh != nil {
+		close(s.refresh)
+		s.refresh = nil
+	}
+	return nil
+}
+
+// Send a typing status, the lock must be held.
+func (s *TypingSender) send(typingType hangouts.TypingType) error {
+	_, err := s.client.SetTyping(s.conversationId, int32(typingType))
+	if err != nil {
+		return err
+	}
+	s.state = typingType
+	return nil
+}
+
+func (s *TypingSender) refreshLoop(done chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.lock.Lock()
+			select {
+			case <-done:
+				// stopped while waiting for the lock
+			default:
+				// a failed refresh is retried on the next tick
+				s.client.SetTyping(s.conversationId, int32(hangouts.TypingType_TYPING_TYPE_STARTED))
+			}
+			s.lock.Unlock()
+		}
+	}
+}
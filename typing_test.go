@@ -0,0 +1,82 @@
+package hangups
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestTypingSenderKeepsStateOnFailure(t *testing.T) {
+	var sent []hangouts.TypingType
+	var lock sync.Mutex
+	fail := false
+	api := newFakeApi(t, func(endpoint string, payload []byte) (proto.Message, error) {
+		request := &hangouts.SetTypingRequest{}
+		if err := proto.Unmarshal(payload, request); err != nil {
+			t.Errorf("bad %s request: %v", endpoint, err)
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		sent = append(sent, request.GetType())
+		if fail {
+			return nil, errors.New("offline")
+		}
+		return &hangouts.SetTypingResponse{}, nil
+	})
+	defer api.restore()
+
+	c := &Client{Session: &Session{}}
+	typing := c.NewTypingSender("conversation")
+	if err := typing.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	lock.Lock()
+	fail = true
+	lock.Unlock()
+	if err := typing.Stop(); err == nil {
+		t.Fatal("Stop succeeded while the api fails")
+	}
+	if typing.state != hangouts.TypingType_TYPING_TYPE_STARTED || typing.refresh == nil {
+		t.Errorf("after a failed Stop: state %v, refreshing %v, want STARTED and refreshing", typing.state, typing.refresh != nil)
+	}
+
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+	if err := typing.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if typing.state != hangouts.TypingType_TYPING_TYPE_STOPPED || typing.refresh != nil {
+		t.Errorf("after Stop: state %v, refreshing %v, want STOPPED and not refreshing", typing.state, typing.refresh != nil)
+	}
+	want := []hangouts.TypingType{
+		hangouts.TypingType_TYPING_TYPE_STARTED,
+		hangouts.TypingType_TYPING_TYPE_STOPPED,
+		hangouts.TypingType_TYPING_TYPE_STOPPED,
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+}
+
+func TestTypingTrackerRemoveChangeHandler(t *testing.T) {
+	tracker := NewTypingTracker(&Client{})
+	defer tracker.Close()
+	kept, removed := 0, 0
+	tracker.AddChangeHandler(func(status *TypingStatus) { kept++ })
+	remove := tracker.AddChangeHandler(func(status *TypingStatus) { removed++ })
+	remove()
+	remove()
+
+	tracker.Update("conv", "1", hangouts.TypingType_TYPING_TYPE_STARTED)
+	tracker.Update("conv", "1", hangouts.TypingType_TYPING_TYPE_STOPPED)
+	if kept != 2 || removed != 0 {
+		t.Errorf("kept handler called %d times, removed one %d times, want 2 and 0", kept, removed)
+	}
+}
@@ -0,0 +1,148 @@
+package hangups
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* Image Upload
+*
+* Images are uploaded to the photos service with a two step resumable upload:
+* a json request opens an upload session and returns the url to send the data
+* to, and the response to that upload carries the id of the new photo. The
+* photo id can then be sent to a conversation with SendPhoto.
+ */
+
+const DefaultImageUploadUrl = "https://docs.google.com/upload/photos/resumable"
+
+type uploadSessionRequest struct {
+	ProtocolVersion      string `json:"protocolVersion"`
+	CreateSessionRequest struct {
+		Fields []uploadSessionField `json:"fields"`
+	} `json:"createSessionRequest"`
+}
+
+type uploadSessionField struct {
+	External struct {
+		Name     string   `json:"name"`
+		Filename string   `json:"filename"`
+		Put      struct{} `json:"put"`
+		Size     int64    `json:"size"`
+	} `json:"external"`
+}
+
+type uploadSessionResponse struct {
+	SessionStatus struct {
+		State                  string `json:"state"`
+		ExternalFieldTransfers []struct {
+			PutInfo struct {
+				Url string `json:"url"`
+			} `json:"putInfo"`
+		} `json:"externalFieldTransfers"`
+		AdditionalInfo struct {
+			RupioInfo struct {
+				CompletionInfo struct {
+					Status               string `json:"status"`
+					CustomerSpecificInfo struct {
+						PhotoId string `json:"photoid"`
+					} `json:"customerSpecificInfo"`
+				} `json:"completionInfo"`
+			} `json:"uploader_service.GoogleRupioAdditionalInfo"`
+		} `json:"additionalInfo"`
+	} `json:"sessionStatus"`
+}
+
+// Upload an image of size bytes read from image and return its photo id.
+// The data is streamed, so image can be a large file.
+func (c *Client) UploadImage(image io.Reader, size int64, filename string) (string, error) {
+	if size <= 0 {
+		return "", errors.New("Can't upload an image without a size")
+	}
+
+	// open the upload session
+	sessionRequest := uploadSessionRequest{ProtocolVersion: "0.8"}
+	field := uploadSessionField{}
+	field.External.Name = "file"
+	field.External.Filename = filename
+	field.External.Size = size
+	sessionRequest.CreateSessionRequest.Fields = []uploadSessionField{field}
+	payload, err := json.Marshal(sessionRequest)
+	if err != nil {
+		return "", err
+	}
+
+	uploadUrl := c.ImageUploadUrl
+	if uploadUrl == "" {
+		uploadUrl = DefaultImageUploadUrl
+	}
+	sessionUrl, err := url.Parse(uploadUrl)
+	if err != nil {
+		return "", err
+	}
+	params := sessionUrl.Query()
+	params.Set("authuser", "0")
+	sessionUrl.RawQuery = params.Encode()
+
+	sessionResponse := &uploadSessionResponse{}
+	err = c.uploadRequest(sessionUrl.String(), "application/x-www-form-urlencoded;charset=UTF-8", bytes.NewReader(payload), int64(len(payload)), sessionResponse)
+	if err != nil {
+		return "", err
+	}
+	transfers := sessionResponse.SessionStatus.ExternalFieldTransfers
+	if len(transfers) == 0 || transfers[0].PutInfo.Url == "" {
+		return "", errors.New("Can't find the image upload url in the upload session")
+	}
+
+	// upload the data
+	uploadResponse := &uploadSessionResponse{}
+	err = c.uploadRequest(transfers[0].PutInfo.Url, "application/octet-stream", image, size, uploadResponse)
+	if err != nil {
+		return "", err
+	}
+	photoId := uploadResponse.SessionStatus.AdditionalInfo.RupioInfo.CompletionInfo.CustomerSpecificInfo.PhotoId
+	if photoId == "" {
+		return "", fmt.Errorf("Image upload didn't return a photo id (state %q)", uploadResponse.SessionStatus.State)
+	}
+	return photoId, nil
+}
+
+// Upload an image and send it to a conversation, with an optional message.
+func (c *Client) SendImage(conversationId string, image io.Reader, size int64, filename string, messageContent *hangouts.MessageContent) (*hangouts.SendChatMessageResponse, error) {
+	photoId, err := c.UploadImage(image, size, filename)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendPhoto(conversationId, photoId, messageContent)
+}
+
+// POST body to the upload service and decode the json response.
+func (c *Client) uploadRequest(endpointUrl, contentType string, body io.Reader, size int64, response interface{}) error {
+	req, err := c.newAuthenticatedRequest("POST", endpointUrl, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("content-type", contentType)
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Image upload failed: %s", resp.Status)
+	}
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bodyBytes, response)
+}
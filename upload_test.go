@@ -0,0 +1,80 @@
+package hangups
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadImage(t *testing.T) {
+	var server *httptest.Server
+	var sessionOpened bool
+	var uploaded string
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Cookie") != "SID=secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/session":
+			request := &uploadSessionRequest{}
+			if err := json.Unmarshal(body, request); err != nil {
+				t.Errorf("session request isn't json: %v", err)
+			}
+			fields := request.CreateSessionRequest.Fields
+			if r.URL.Query().Get("authuser") != "0" || len(fields) != 1 ||
+				fields[0].External.Filename != "cat.png" || fields[0].External.Size != 9 {
+				t.Errorf("unexpected session request %s %s", r.URL, body)
+			}
+			sessionOpened = true
+			fmt.Fprintf(w, `{"sessionStatus":{"state":"OPEN","externalFieldTransfers":[{"putInfo":{"url":"%s/put?upload_id=1"}}]}}`, server.URL)
+		case "/put":
+			if !sessionOpened || r.URL.Query().Get("upload_id") != "1" {
+				t.Errorf("unexpected upload to %s", r.URL)
+			}
+			uploaded = string(body)
+			fmt.Fprint(w, `{"sessionStatus":{"state":"FINALIZED","additionalInfo":{"uploader_service.GoogleRupioAdditionalInfo":`+
+				`{"completionInfo":{"status":"SUCCESS","customerSpecificInfo":{"photoid":"5984213564835"}}}}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{
+		Session:        &Session{Cookies: "SID=secret", Sapisid: "sapisid"},
+		ImageUploadUrl: server.URL + "/session",
+	}
+	photoId, err := c.UploadImage(strings.NewReader("imagedata"), 9, "cat.png")
+	if err != nil {
+		t.Fatalf("UploadImage failed: %v", err)
+	}
+	if photoId != "5984213564835" {
+		t.Errorf("UploadImage returned photo id %q, want \"5984213564835\"", photoId)
+	}
+	if uploaded != "imagedata" {
+		t.Errorf("uploaded %q, want \"imagedata\"", uploaded)
+	}
+}
+
+func TestUploadImageWithoutPhotoId(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/session" {
+			fmt.Fprintf(w, `{"sessionStatus":{"externalFieldTransfers":[{"putInfo":{"url":"%s/put"}}]}}`, server.URL)
+			return
+		}
+		fmt.Fprint(w, `{"sessionStatus":{"state":"FAILED"}}`)
+	}))
+	defer server.Close()
+
+	c := &Client{Session: &Session{}, ImageUploadUrl: server.URL + "/session"}
+	if _, err := c.UploadImage(strings.NewReader("imagedata"), 9, "cat.png"); err == nil {
+		t.Error("UploadImage succeeded without a photo id, want an error")
+	}
+}
@@ -0,0 +1,246 @@
+package hangups
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+/*
+* User List
+*
+* UserList caches what is known about users: the self user from GetSelfInfo,
+* fallback names from conversation participant data and full entities from
+* GetEntityById. Users missing from the cache, or whose entity is older than
+* the TTL, are fetched in one batch when they are asked for. Users the server
+* returns no entity for aren't asked for again before the TTL either.
+ */
+
+// Default time after which UserList refetches a user's entity.
+const DefaultUserTTL = time.Hour
+
+// A Hangouts user.
+type User struct {
+	GaiaId      string
+	DisplayName string
+	FirstName   string
+	Emails      []string
+	Phones      []string
+	PhotoUrl    string
+	IsSelf      bool
+
+	// when the entity was fetched, zero if only participant data is known
+	fetched time.Time
+}
+
+// Return the name to show for the user: the display name, else the first
+// name, else "Unknown".
+func (u *User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.FirstName != "" {
+		return u.FirstName
+	}
+	return "Unknown"
+}
+
+// Create a user from an entity.
+func NewUserFromEntity(entity *hangouts.Entity, isSelf bool) *User {
+	properties := entity.GetProperties()
+	user := &User{
+		GaiaId:      entity.Id.GetGaiaId(),
+		DisplayName: properties.GetDisplayName(),
+		FirstName:   properties.GetFirstName(),
+		Emails:      properties.GetEmail(),
+		Phones:      properties.GetPhone(),
+		PhotoUrl:    properties.GetPhotoUrl(),
+		IsSelf:      isSelf,
+	}
+	if user.PhotoUrl != "" && user.PhotoUrl[0] == '/' {
+		// photo urls come without a scheme ("//lh3.googleusercontent.com/...")
+		user.PhotoUrl = "https:" + user.PhotoUrl
+	}
+	return user
+}
+
+// Cache of users, safe for concurrent use.
+type UserList struct {
+	client        *Client
+	removeHandler func() // removes the StateUpdate handler, see Close
+
+	// Age after which a user's entity is fetched again, DefaultUserTTL
+	// when zero. Set it before the list is shared between goroutines.
+	TTL time.Duration
+
+	selfId string
+	users  map[string]*User
+	// when an entity was last requested, keyed by gaia id, whether or not
+	// the server returned it, set before the request is made
+	requested map[string]time.Time
+	usersLock sync.RWMutex
+}
+
+// Create a user list seeded with the self user (see GetSelfInfo) and the
+// participants of the client's cached conversations. The list keeps adding
+// participants of the conversations the client processes afterwards.
+func NewUserList(c *Client) *UserList {
+	list := &UserList{client: c, users: make(map[string]*User), requested: make(map[string]time.Time)}
+	if self := c.SelfEntity(); self != nil {
+		list.selfId = self.Id.GetGaiaId()
+		list.AddEntities([]*hangouts.Entity{self})
+	}
+	for _, conversation := range c.CachedConversations() {
+		list.AddParticipants(conversation)
+	}
+	list.removeHandler = c.AddStateUpdateHandler(func(update *hangouts.StateUpdate) {
+		list.AddParticipants(update.Conversation)
+		list.AddParticipants(update.GetConversationNotification().GetConversation())
+	})
+	return list
+}
+
+// Stop adding the participants of the conversations the client processes.
+func (list *UserList) Close() {
+	list.removeHandler()
+}
+
+// Add or refresh users from entities.
+func (list *UserList) AddEntities(entities []*hangouts.Entity) {
+	now := time.Now()
+	list.usersLock.Lock()
+	defer list.usersLock.Unlock()
+	for _, entity := range entities {
+		if entity.Id.GetGaiaId() == "" {
+			continue
+		}
+		user := NewUserFromEntity(entity, entity.Id.GetGaiaId() == list.selfId)
+		user.fetched = now
+		list.users[user.GaiaId] = user
+	}
+}
+
+// Add the participants of a conversation not known yet, with their
+// fallback names. Their entities are fetched when they are asked for.
+func (list *UserList) AddParticipants(conversation *hangouts.Conversation) {
+	participants := conversation.GetParticipantData()
+	if len(participants) == 0 {
+		return
+	}
+	list.usersLock.Lock()
+	defer list.usersLock.Unlock()
+	for _, participantData := range participants {
+		gaiaId := participantData.Id.GetGaiaId()
+		if _, found := list.users[gaiaId]; found || gaiaId == "" {
+			continue
+		}
+		list.users[gaiaId] = &User{
+			GaiaId:      gaiaId,
+			DisplayName: participantData.GetFallbackName(),
+			IsSelf:      gaiaId == list.selfId,
+		}
+	}
+}
+
+// Return a cached user without fetching anything, nil if unknown.
+func (list *UserList) Cached(gaiaId string) *User {
+	list.usersLock.RLock()
+	defer list.usersLock.RUnlock()
+	return list.users[gaiaId]
+}
+
+// Return the self user, nil if GetSelfInfo hadn't been called when the list
+// was created.
+func (list *UserList) Self() *User {
+	return list.Cached(list.selfId)
+}
+
+// Return all cached users, sorted by gaia id.
+func (list *UserList) Users() []*User {
+	list.usersLock.RLock()
+	users := make([]*User, 0, len(list.users))
+	for _, user := range list.users {
+		users = append(users, user)
+	}
+	list.usersLock.RUnlock()
+	sort.Sort(usersByGaiaId(users))
+	return users
+}
+
+// Return a user, fetching its entity if it is unknown or stale.
+// See GetUsers.
+func (list *UserList) Get(gaiaId string) (*User, error) {
+	users, err := list.GetUsers([]string{gaiaId})
+	return users[0], err
+}
+
+// Return users in the order of gaiaIds, fetching the entities of unknown
+// and stale ones in a single request. Users whose entity was requested
+// within the TTL aren't requested again, even if the server didn't return
+// it or the request is still in flight. If the request fails, the error is
+// returned along with the cached users, and users known only by id, and the
+// users are requested again on the next call.
+func (list *UserList) GetUsers(gaiaIds []string) ([]*User, error) {
+	ttl := list.TTL
+	if ttl <= 0 {
+		ttl = DefaultUserTTL
+	}
+	now := time.Now()
+	missing := make([]string, 0)
+	seen := make(map[string]bool)
+	list.usersLock.Lock()
+	for _, gaiaId := range gaiaIds {
+		if seen[gaiaId] {
+			continue
+		}
+		seen[gaiaId] = true
+		user := list.users[gaiaId]
+		if (user == nil || now.Sub(user.fetched) > ttl) && now.Sub(list.requested[gaiaId]) > ttl {
+			missing = append(missing, gaiaId)
+			list.requested[gaiaId] = now
+		}
+	}
+	list.usersLock.Unlock()
+
+	var err error
+	if len(missing) > 0 {
+		var response *hangouts.GetEntityByIdResponse
+		response, err = list.client.GetEntityById(missing)
+		if err == nil {
+			list.AddEntities(response.Entity)
+		} else {
+			list.forgetRequested(missing, now)
+		}
+	}
+
+	users := make([]*User, len(gaiaIds))
+	list.usersLock.RLock()
+	defer list.usersLock.RUnlock()
+	for ind, gaiaId := range gaiaIds {
+		users[ind] = list.users[gaiaId]
+		if users[ind] == nil {
+			users[ind] = &User{GaiaId: gaiaId, IsSelf: gaiaId == list.selfId}
+		}
+	}
+	return users, err
+}
+
+// Forget that the entities of users were requested at requested, after the
+// request failed, unless they were requested again since.
+func (list *UserList) forgetRequested(gaiaIds []string, requested time.Time) {
+	list.usersLock.Lock()
+	defer list.usersLock.Unlock()
+	for _, gaiaId := range gaiaIds {
+		if list.requested[gaiaId].Equal(requested) {
+			delete(list.requested, gaiaId)
+		}
+	}
+}
+
+type usersByGaiaId []*User
+
+func (u usersByGaiaId) Len() int           { return len(u) }
+func (u usersByGaiaId) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u usersByGaiaId) Less(i, j int) bool { return u[i].GaiaId < u[j].GaiaId }
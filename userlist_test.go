@@ -0,0 +1,119 @@
+package hangups
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gpavlidi/go-hangups/proto"
+)
+
+func TestUserListGetUsersRequestsOncePerTTL(t *testing.T) {
+	var requested [][]string
+	api := newFakeApi(t, func(endpoint string, payload []byte) (proto.Message, error) {
+		request := &hangouts.GetEntityByIdRequest{}
+		if err := proto.Unmarshal(payload, request); err != nil {
+			t.Fatalf("bad %s request: %v", endpoint, err)
+		}
+		ids := make([]string, 0)
+		for _, spec := range request.BatchLookupSpec {
+			ids = append(ids, spec.GetGaiaId())
+		}
+		requested = append(requested, ids)
+		// "gone" has no entity anymore
+		return &hangouts.GetEntityByIdResponse{Entity: []*hangouts.Entity{{
+			Id:         &hangouts.ParticipantId{GaiaId: proto.String("1")},
+			Properties: &hangouts.EntityProperties{DisplayName: proto.String("Alice")},
+		}}}, nil
+	})
+	defer api.restore()
+
+	c := &Client{Session: &Session{}}
+	list := NewUserList(c)
+	list.AddParticipants(&hangouts.Conversation{ParticipantData: []*hangouts.ConversationParticipantData{{
+		Id:           &hangouts.ParticipantId{GaiaId: proto.String("2")},
+		FallbackName: proto.String("Bob"),
+	}}})
+
+	ids := []string{"1", "2", "gone", "1"}
+	for round := 0; round < 2; round++ {
+		users, err := list.GetUsers(ids)
+		if err != nil {
+			t.Fatalf("GetUsers failed: %v", err)
+		}
+		names := []string{users[0].Name(), users[1].Name(), users[2].Name(), users[3].Name()}
+		if want := []string{"Alice", "Bob", "Unknown", "Alice"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("round %d: names %v, want %v", round, names, want)
+		}
+	}
+	if want := [][]string{{"1", "2", "gone"}}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested %v, want %v", requested, want)
+	}
+
+	// past the TTL, the users without an entity are requested again
+	list.TTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	list.GetUsers(ids)
+	if len(requested) != 2 || len(requested[1]) != 3 {
+		t.Errorf("requested %v after the TTL, want all ids again", requested)
+	}
+}
+
+func TestUserListGetUsersSkipsInFlightAndRetriesFailed(t *testing.T) {
+	arrived := make(chan []string)
+	release := make(chan error)
+	api := newFakeApi(t, func(endpoint string, payload []byte) (proto.Message, error) {
+		request := &hangouts.GetEntityByIdRequest{}
+		if err := proto.Unmarshal(payload, request); err != nil {
+			t.Errorf("bad %s request: %v", endpoint, err)
+		}
+		ids := make([]string, 0)
+		for _, spec := range request.BatchLookupSpec {
+			ids = append(ids, spec.GetGaiaId())
+		}
+		arrived <- ids
+		if err := <-release; err != nil {
+			return nil, err
+		}
+		return &hangouts.GetEntityByIdResponse{}, nil
+	})
+	defer api.restore()
+
+	list := NewUserList(&Client{Session: &Session{}})
+	done := make(chan error)
+	go func() {
+		_, err := list.GetUsers([]string{"1"})
+		done <- err
+	}()
+	if ids := <-arrived; !reflect.DeepEqual(ids, []string{"1"}) {
+		t.Errorf("requested %v, want [1]", ids)
+	}
+
+	// while the first request is in flight, user 1 isn't requested again
+	go func() {
+		_, err := list.GetUsers([]string{"1"})
+		done <- err
+	}()
+	if err := <-done; err != nil {
+		t.Errorf("GetUsers of an in-flight user failed: %v", err)
+	}
+	release <- errors.New("offline")
+	if err := <-done; err == nil {
+		t.Error("GetUsers succeeded though the request failed")
+	}
+
+	// after the failure, user 1 is requested again
+	go func() {
+		_, err := list.GetUsers([]string{"1"})
+		done <- err
+	}()
+	if ids := <-arrived; !reflect.DeepEqual(ids, []string{"1"}) {
+		t.Errorf("requested %v after the failure, want [1]", ids)
+	}
+	release <- nil
+	if err := <-done; err != nil {
+		t.Errorf("GetUsers failed: %v", err)
+	}
+}